@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"go.uber.org/atomic"
 
@@ -116,17 +117,25 @@ func (a *Application) Stop() error {
 	probe.UnregisterLivenessProbe(version.Project)
 	probe.UnregisterReadinessProbe(version.Project)
 
-	for i := len(a.servers); i >= 0; i-- {
-		a.servers[i].Stop()
+	var result error
+	for i := len(a.servers) - 1; i >= 0; i-- {
+		if err := a.servers[i].Stop(); err != nil {
+			log.Error(err)
+			result = multierror.Append(result, err)
+		}
 	}
 
 	a.pool.Close()
 
-	log.Info("application stopped ok")
-
 	probe.DisableLivenessProbe()
 	probe.DisableReadinessProbe()
 
+	if result != nil {
+		return result
+	}
+
+	log.Info("application stopped ok")
+
 	return nil
 }
 
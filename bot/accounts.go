@@ -0,0 +1,109 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+const (
+	// RPL_WHOSPCRPL, a WHOX reply
+	rplWhoSpcRpl = "354"
+	// marks the WHOX replies to the queries of the bot
+	whoToken = "152"
+
+	// the capabilities telling the accounts of the nicks joining and
+	// logging in or out
+	accountCaps = "account-notify extended-join"
+)
+
+// accounts tracks the services accounts the nicks in the channels are logged
+// in with. Nicks are kept as they come from the server, i.e. encoded.
+type accounts struct {
+	mu     sync.Mutex
+	byNick map[string]string
+}
+
+func newAccounts() *accounts {
+	return &accounts{
+		byNick: map[string]string{},
+	}
+}
+
+// get returns the account of the nick or an empty string if it is not logged
+// in or not known.
+func (as *accounts) get(nick string) string {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.byNick[strings.ToLower(nick)]
+}
+
+func (as *accounts) reset() {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.byNick = map[string]string{}
+}
+
+func (as *accounts) set(nick, account string) {
+	nick = strings.ToLower(nick)
+	// "*" is sent by extended-join and account-notify, "0" by WHOX
+	if account == "" || account == "*" || account == "0" {
+		delete(as.byNick, nick)
+		return
+	}
+	as.byNick[nick] = account
+}
+
+func (as *accounts) update(m *hbot.Message) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	switch m.Command {
+	case rplWhoSpcRpl:
+		// :server 354 me 152 nick account
+		if m.Param(1) == whoToken {
+			as.set(m.Param(2), m.Param(3))
+		}
+	case "JOIN":
+		// :nick!user@host JOIN #channel account :realname with extended-join
+		if len(m.Params) > 2 {
+			as.set(m.From, m.Param(1))
+		}
+	case "ACCOUNT":
+		as.set(m.From, m.Param(0))
+	case "QUIT":
+		delete(as.byNick, strings.ToLower(m.From))
+	case "NICK":
+		if account, ok := as.byNick[strings.ToLower(m.From)]; ok {
+			delete(as.byNick, strings.ToLower(m.From))
+			as.byNick[strings.ToLower(m.Param(0))] = account
+		}
+	}
+}
+
+// accountsTrigger requests the account capabilities once the bot is
+// registered, asks for the accounts of the nicks in the channels it joins and
+// keeps track of them. It never consumes the message.
+func (b *Bot) accountsTrigger(s *session) hbot.Trigger {
+	return hbot.Trigger{
+		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
+			switch m.Command {
+			case rplYourHost, rplWhoSpcRpl, "JOIN", "ACCOUNT", "QUIT", "NICK":
+				return true
+			}
+			return false
+		},
+		Action: func(bot *hbot.Bot, m *hbot.Message) bool {
+			switch {
+			case m.Command == rplYourHost:
+				s.queue.pushControl("CAP REQ :" + accountCaps)
+			case m.Command == "JOIN" && m.From == bot.Nick:
+				s.queue.pushControl("WHO " + m.Param(0) + " %tna," + whoToken)
+			default:
+				b.accounts.update(m)
+			}
+			return false
+		},
+	}
+}
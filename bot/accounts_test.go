@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func TestAccounts(t *testing.T) {
+	as := newAccounts()
+	for _, line := range []string{
+		":server 354 calc 152 Alice alice",
+		":server 354 calc 152 bob 0",
+		":server 354 calc 999 carol carol",
+		":dave!d@h JOIN #test dave :Dave",
+		":erin!e@h JOIN #test * :Erin",
+		":frank!f@h JOIN #test",
+		":erin!e@h ACCOUNT erin",
+		":dave!d@h NICK dave2",
+	} {
+		as.update(hbot.ParseMessage(line))
+	}
+	assert.Equal(t, "alice", as.get("alice"))
+	assert.Equal(t, "", as.get("bob"))
+	assert.Equal(t, "", as.get("carol"))
+	assert.Equal(t, "", as.get("dave"))
+	assert.Equal(t, "dave", as.get("dave2"))
+	assert.Equal(t, "erin", as.get("erin"))
+	assert.Equal(t, "", as.get("frank"))
+
+	as.update(hbot.ParseMessage(":erin!e@h ACCOUNT *"))
+	assert.Equal(t, "", as.get("erin"))
+	as.update(hbot.ParseMessage(":alice!a@h QUIT :bye"))
+	assert.Equal(t, "", as.get("alice"))
+}
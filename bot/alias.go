@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	// content of an alias is the target key marked with aliasMark, content
+	// starting with the mark doubled is text: "@@here" is shown as "@here"
+	aliasMark    = "@"
+	escapedAlias = aliasMark + aliasMark
+
+	defaultMaxAliasDepth = 5
+)
+
+// aliasCalc makes the key an alias of the target: "alias = target".
+func (b *Bot) aliasCalc(req request, data string) (string, error) {
+	parts := strings.SplitN(data, "=", 2)
+	if len(parts) < 2 {
+		return "", errors.Errorf("usage: %s", b.usage(req.channel, b.commands.lookup("alias")))
+	}
+	target := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(parts[1]), aliasMark))
+	return b.setCalc(req, parts[0], aliasMark+target)
+}
+
+// resolveCalc returns the newest version of the key following aliases and
+// the number of versions, zero if there are none. The path holds the key and
+// every alias target visited, the last one is the key the calc belongs to.
+func (b *Bot) resolveCalc(channel, key string) (newest repository.IrcCalc, total int, path []string, err error) {
+	path = []string{key}
+	for {
+		newest, total, err = b.getNewestCalc(channel, key)
+		if err != nil || total == 0 {
+			return
+		}
+		target, ok := aliasTarget(newest.Content)
+		if !ok {
+			return
+		}
+		for _, visited := range path {
+			if b.normKey(visited) == b.normKey(target) {
+				return newest, 0, path, errors.Errorf("alias loop %s -> %s", strings.Join(path, " -> "), target)
+			}
+		}
+		if len(path) > b.conf.MaxAliasDepth {
+			return newest, 0, path, errors.Errorf("too many aliases %s -> %s", strings.Join(path, " -> "), target)
+		}
+		path = append(path, target)
+		key = target
+	}
+}
+
+// checkAlias makes sure that the key can be an alias of the target: the
+// target exists and does not lead back to the key.
+func (b *Bot) checkAlias(channel, key, target string) error {
+	if target == "" {
+		return errors.New("empty alias target")
+	}
+	if b.normKey(target) == b.normKey(key) {
+		return errors.Errorf("%q can not be an alias of itself", key)
+	}
+	_, total, path, err := b.resolveCalc(channel, target)
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return errors.Errorf("there is no calcs with %q to alias, start the content with %s for a plain %s",
+			path[len(path)-1], escapedAlias, aliasMark)
+	}
+	for _, visited := range path {
+		if b.normKey(visited) == b.normKey(key) {
+			return errors.Errorf("alias loop %s -> %s", key, strings.Join(path, " -> "))
+		}
+	}
+	if len(path) > b.conf.MaxAliasDepth {
+		return errors.Errorf("too many aliases %s -> %s", key, strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// getNewestCalc returns the newest version of the key and the number of
+// versions in the channel namespace or, if there are none, in the global one.
+func (b *Bot) getNewestCalc(channel, key string) (repository.IrcCalc, int, error) {
+	newest, total, err := b.repo.GetNewestCalcVersion(context.Background(), repository.GetNewestCalcVersionParams{
+		Channel: channel,
+		NormKey: b.normKey(key),
+	})
+	global := b.fallbackChannel(channel)
+	if err != nil || total > 0 || global == "" {
+		return newest, int(total), err
+	}
+	newest, total, err = b.repo.GetNewestCalcVersion(context.Background(), repository.GetNewestCalcVersionParams{
+		Channel: global,
+		NormKey: b.normKey(key),
+	})
+	return newest, int(total), err
+}
+
+// calcVersions returns the versions of the calc selected by the index and the
+// index of the first one. Only the versions selected are fetched, the newest
+// one is known already.
+func (b *Bot) calcVersions(newest repository.IrcCalc, total int, index string) ([]repository.IrcCalc, int, error) {
+	first, last, err := versionRange(index, total)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := b.checkShown(index, first, last); err != nil {
+		return nil, 0, err
+	}
+	if first == total-1 {
+		return []repository.IrcCalc{newest}, first, nil
+	}
+	calcs, _, err := b.repo.GetCalcVersions(context.Background(), repository.GetCalcVersionsParams{
+		Channel: newest.Channel,
+		NormKey: newest.NormKey,
+		Off:     int32(first),
+		Lim:     int32(last - first + 1),
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(calcs) == 0 {
+		return nil, 0, errors.Errorf("calc index %s out of range", index)
+	}
+	return calcs, first, nil
+}
+
+// aliasTarget returns the key the content redirects to, if it is an alias.
+func aliasTarget(content string) (string, bool) {
+	if !strings.HasPrefix(content, aliasMark) || strings.HasPrefix(content, escapedAlias) {
+		return "", false
+	}
+	target := strings.TrimSpace(content[len(aliasMark):])
+	return target, target != ""
+}
+
+func redirectFooter(path []string) string {
+	if len(path) < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (redirected from %s)", strings.Join(path[:len(path)-1], " -> "))
+}
+
+// calcText returns the content as it is shown, the escaped alias mark is
+// unescaped.
+func calcText(content string) string {
+	if strings.HasPrefix(content, escapedAlias) {
+		return content[len(aliasMark):]
+	}
+	return content
+}
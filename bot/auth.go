@@ -0,0 +1,173 @@
+package bot
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+	hbot "github.com/whyrusleeping/hellabot"
+
+	"github.com/adzip-kadum/irc-calc/log"
+)
+
+type SASLConfig struct {
+	Mechanism string `yaml:"mechanism"`
+	User      string `yaml:"user"`
+	Password  string `yaml:"password"`
+}
+
+const (
+	saslPlain    = "PLAIN"
+	saslExternal = "EXTERNAL"
+
+	errNickLocked  = "902"
+	rplSASLSuccess = "903"
+	errSASLFail    = "904"
+	errSASLTooLong = "905"
+	errSASLAborted = "906"
+	errSASLAlready = "907"
+	rplSASLMechs   = "908"
+
+	nickServ = "NickServ"
+)
+
+// redacted returns the config without passwords, for logging.
+func (c Config) redacted() Config {
+	if c.SASL.Password != "" {
+		c.SASL.Password = "***"
+	}
+	if c.NickServPassword != "" {
+		c.NickServPassword = "***"
+	}
+	return c
+}
+
+// initAuth checks the TLS and authentication settings and loads the client
+// certificate.
+func (b *Bot) initAuth() error {
+	conf := &b.conf
+	conf.SASL.Mechanism = strings.ToUpper(conf.SASL.Mechanism)
+	switch conf.SASL.Mechanism {
+	case "":
+	case saslPlain:
+		if conf.SASL.User == "" {
+			conf.SASL.User = conf.Nickname
+		}
+		if conf.SASL.Password == "" {
+			return errors.New("sasl PLAIN requires a password")
+		}
+	case saslExternal:
+		if !conf.TLS || conf.TLSCert == "" {
+			return errors.New("sasl EXTERNAL requires tls with a client certificate")
+		}
+	default:
+		return errors.Errorf("unsupported sasl mechanism %q", conf.SASL.Mechanism)
+	}
+
+	if !conf.TLS {
+		return nil
+	}
+	b.tlsConfig = &tls.Config{
+		InsecureSkipVerify: conf.TLSInsecureSkipVerify,
+	}
+	if conf.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		b.tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+// saslTrigger authenticates the session with the configured mechanism. It
+// consumes the SASL messages, so the PLAIN only handler of hellabot never
+// gets them. A rejected authentication drops the connection.
+func (b *Bot) saslTrigger(s *session) hbot.Trigger {
+	return hbot.Trigger{
+		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
+			if b.conf.SASL.Mechanism == "" {
+				return false
+			}
+			switch m.Command {
+			case "CAP":
+				return strings.TrimSpace(m.Content) == "sasl"
+			case "AUTHENTICATE", errNickLocked, rplSASLSuccess, errSASLFail,
+				errSASLTooLong, errSASLAborted, errSASLAlready, rplSASLMechs:
+				return true
+			}
+			return false
+		},
+		Action: func(bot *hbot.Bot, m *hbot.Message) bool {
+			switch m.Command {
+			case "CAP":
+				switch m.Param(1) {
+				case "ACK":
+					s.queue.pushControl("AUTHENTICATE " + b.conf.SASL.Mechanism)
+				case "NAK":
+					if b.conf.NickServPassword == "" {
+						s.fail(errors.Errorf("%s: server does not support sasl", s.address))
+						return true
+					}
+					log.Info("sasl is not supported, falling back to NickServ", log.String("address", s.address))
+					s.queue.pushControl("CAP END")
+				}
+			case "AUTHENTICATE":
+				if m.Param(0) == "+" {
+					s.queue.pushControl("AUTHENTICATE " + b.saslResponse())
+				}
+			case rplSASLSuccess:
+				s.authenticated.Store(true)
+				log.Info("sasl authentication succeeded", log.String("address", s.address))
+				s.queue.pushControl("CAP END")
+			case rplSASLMechs:
+				// followed by ERR_SASLFAIL
+				log.Info("sasl mechanisms", log.String("address", s.address), log.String("mechanisms", m.Param(1)))
+			case errSASLAlready:
+				s.authenticated.Store(true)
+			default:
+				s.fail(errors.Errorf("%s: sasl %s authentication failed: %s %s",
+					s.address, b.conf.SASL.Mechanism, m.Command, m.Content))
+			}
+			return true
+		},
+	}
+}
+
+func (b *Bot) saslResponse() string {
+	if b.conf.SASL.Mechanism == saslExternal {
+		return "+"
+	}
+	user := []byte(b.conf.SASL.User)
+	response := bytes.Join([][]byte{user, user, []byte(b.conf.SASL.Password)}, []byte{0})
+	return base64.StdEncoding.EncodeToString(response)
+}
+
+// identify sends the password to NickServ once the bot is registered, unless
+// it was authenticated with SASL.
+func (b *Bot) identify(s *session) {
+	if b.conf.NickServPassword == "" || s.authenticated.Load() {
+		return
+	}
+	s.queue.pushControl("PRIVMSG " + nickServ + " :IDENTIFY " + b.conf.NickServPassword)
+}
+
+// nickServTrigger logs NickServ notices and drops the connection when the
+// password is rejected.
+func (b *Bot) nickServTrigger(s *session) hbot.Trigger {
+	return hbot.Trigger{
+		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
+			return b.conf.NickServPassword != "" && m.Command == "NOTICE" && strings.EqualFold(m.From, nickServ)
+		},
+		Action: func(bot *hbot.Bot, m *hbot.Message) bool {
+			log.Info("nickserv", log.String("address", s.address), log.String("notice", m.Content))
+			notice := strings.ToLower(m.Content)
+			if strings.Contains(notice, "invalid password") || strings.Contains(notice, "incorrect password") {
+				s.fail(errors.Errorf("%s: NickServ rejected the password: %s", s.address, m.Content))
+			}
+			return true
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saslServer accepts PLAIN authentication with the password.
+func saslServer(password string) func(conn net.Conn, line string) {
+	return func(conn net.Conn, line string) {
+		switch {
+		case line == "CAP REQ :sasl":
+			fmt.Fprint(conn, ":fake CAP * ACK :sasl\r\n")
+		case line == "AUTHENTICATE PLAIN":
+			fmt.Fprint(conn, "AUTHENTICATE +\r\n")
+		case strings.HasPrefix(line, "AUTHENTICATE "):
+			response, _ := base64.StdEncoding.DecodeString(line[len("AUTHENTICATE "):])
+			if strings.HasSuffix(string(response), "\x00"+password) {
+				fmt.Fprint(conn, ":fake 903 calc :SASL authentication successful\r\n")
+			} else {
+				fmt.Fprint(conn, ":fake 904 calc :SASL authentication failed\r\n")
+			}
+		case line == "CAP END":
+			welcome(conn, "USER ")
+		case strings.HasPrefix(line, "QUIT "):
+			welcome(conn, line)
+		}
+	}
+}
+
+func newSASLBot(t *testing.T, address, password string) *Bot {
+	b, err := NewBot(Config{
+		Channels:     []string{"#test"},
+		Nickname:     fmt.Sprintf("calc%d", rand.Int63()),
+		Addresses:    []string{address},
+		Encoding:     "koi8-r",
+		ReconnectMin: 10 * time.Millisecond,
+		ReconnectMax: 50 * time.Millisecond,
+		SASL: SASLConfig{
+			Mechanism: "plain",
+			Password:  password,
+		},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { b.Stop() })
+	return b
+}
+
+func TestSASL(t *testing.T) {
+	address, _ := fakeServer(t, saslServer("secret"))
+	b := newSASLBot(t, address, "secret")
+	require.NoError(t, b.Start())
+	require.Eventually(t, func() bool { return b.Server() == address }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSASLRejected(t *testing.T) {
+	address, _ := fakeServer(t, saslServer("secret"))
+	b := newSASLBot(t, address, "wrong")
+	require.NoError(t, b.Start())
+	require.Eventually(t, func() bool { return b.Reconnects() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "", b.Server())
+}
+
+func TestInitAuth(t *testing.T) {
+	for _, conf := range []Config{
+		{SASL: SASLConfig{Mechanism: "plain"}},
+		{SASL: SASLConfig{Mechanism: "external"}},
+		{SASL: SASLConfig{Mechanism: "scram-sha-256"}},
+		{TLS: true, TLSCert: "missing.pem", TLSKey: "missing.key"},
+	} {
+		b := &Bot{conf: conf}
+		assert.Error(t, b.initAuth(), conf)
+	}
+}
@@ -2,182 +2,637 @@ package bot
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	hbot "github.com/whyrusleeping/hellabot"
-	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/charmap"
+	"go.uber.org/atomic"
 	llog "gopkg.in/inconshreveable/log15.v2"
 
 	"github.com/adzip-kadum/irc-calc/log"
 	"github.com/adzip-kadum/irc-calc/postgres"
 	"github.com/adzip-kadum/irc-calc/repository"
+	"github.com/adzip-kadum/irc-calc/worker"
 )
 
 type Config struct {
-	Channel   string   `yaml:"channel"`
-	Nickname  string   `yaml:"nick"`
-	Addresses []string `yaml:"addresses"`
-	Encoding  string   `yaml:"encoding"`
+	Channel         string                     `yaml:"channel"`
+	Channels        []string                   `yaml:"channels"`
+	Prefix          string                     `yaml:"prefix"`
+	Prefixes        map[string]string          `yaml:"prefixes"`
+	Global          string                     `yaml:"global"`
+	Nickname        string                     `yaml:"nick"`
+	Addresses       []string                   `yaml:"addresses"`
+	Encoding        string                     `yaml:"encoding"`
+	Unencodable     string                     `yaml:"unencodable"`
+	Admins          []string                   `yaml:"admins"`
+	FoldYo          bool                       `yaml:"foldYo"`
+	MaxAliasDepth   int                        `yaml:"maxAliasDepth"`
+	DefaultVersion  string                     `yaml:"defaultVersion"`
+	DefaultVersions map[string]string          `yaml:"defaultVersions"`
+	DialTimeout     time.Duration              `yaml:"dialTimeout"`
+	ReconnectMin    time.Duration              `yaml:"reconnectMin"`
+	ReconnectMax    time.Duration              `yaml:"reconnectMax"`
+	QuitMessage     string                     `yaml:"quitMessage"`
+	StopTimeout     time.Duration              `yaml:"stopTimeout"`
+	FloodRate       time.Duration              `yaml:"floodRate"`
+	FloodBurst      int                        `yaml:"floodBurst"`
+	QueueSize       int                        `yaml:"queueSize"`
+	MaxReplyLines   int                        `yaml:"maxReplyLines"`
+	RandomWindow    time.Duration              `yaml:"randomWindow"`
+	CalcOfTheDay    string                     `yaml:"calcOfTheDay"`
+	RateLimit       RateLimitConfig            `yaml:"rateLimit"`
+	RateLimits      map[string]RateLimitConfig `yaml:"rateLimits"`
+
+	TLS                   bool       `yaml:"tls"`
+	TLSInsecureSkipVerify bool       `yaml:"tlsInsecureSkipVerify"`
+	TLSCert               string     `yaml:"tlsCert"`
+	TLSKey                string     `yaml:"tlsKey"`
+	SASL                  SASLConfig `yaml:"sasl"`
+	NickServPassword      string     `yaml:"nickServPassword"`
 }
 
 type Bot struct {
-	conf    Config
-	repo    *repository.CalcsRepository
-	encoder *encoding.Encoder
-	decoder *encoding.Decoder
+	conf       Config
+	repo       *repository.CalcsRepository
+	members    *members
+	commands   *commands
+	limits     *limiter
+	more       *moreBuffer
+	charset    *charset
+	charsets   *nickCharsets
+	lookups    *lookups
+	ignores    *ignoreList
+	accounts   *accounts
+	tlsConfig  *tls.Config
+	session    *session
+	sessionMu  sync.RWMutex
+	closer     *worker.Closer
+	handlers   sync.WaitGroup
+	stopMu     sync.Mutex
+	stopped    bool
+	server     *atomic.String
+	reconnects *atomic.Int64
+	sent       *atomic.Int64
+	dropped    *atomic.Int64
+	// the time of the calc of the day and the day it was last posted, used
+	// by the daily worker only
+	dailyAt   time.Duration
+	dailyDone time.Time
 }
 
-var (
-	encoders = map[string]*encoding.Encoder{
-		"windows-1251": charmap.Windows1251.NewEncoder(),
-		"koi8-r":       charmap.KOI8R.NewEncoder(),
+func NewBot(conf Config, pool *postgres.PgxPool) (*Bot, error) {
+	bot := &Bot{
+		conf:       conf,
+		repo:       repository.NewCalcsRepository(pool),
+		members:    newMembers(),
+		limits:     newLimiter(),
+		more:       newMoreBuffer(),
+		charset:    lookupCharset(conf.Encoding),
+		charsets:   newNickCharsets(),
+		lookups:    newLookups(),
+		ignores:    newIgnoreList(),
+		accounts:   newAccounts(),
+		server:     atomic.NewString(""),
+		reconnects: atomic.NewInt64(0),
+		sent:       atomic.NewInt64(0),
+		dropped:    atomic.NewInt64(0),
 	}
-	decoders = map[string]*encoding.Decoder{
-		"windows-1251": charmap.Windows1251.NewDecoder(),
-		"koi8-r":       charmap.KOI8R.NewDecoder(),
+
+	if bot.charset == nil {
+		return nil, errors.Errorf("Unknown encoding %q, known: %s", conf.Encoding, charsetNames())
 	}
-)
+	policy, err := checkFallback(conf.Unencodable)
+	if err != nil {
+		return nil, err
+	}
+	bot.conf.Unencodable = policy
 
-func NewBot(conf Config, pool *postgres.PgxPool) (*Bot, error) {
-	bot := &Bot{
-		conf:    conf,
-		repo:    repository.NewCalcsRepository(pool),
-		encoder: encoders[conf.Encoding],
-		decoder: decoders[conf.Encoding],
+	if conf.Channel != "" && bot.channel(conf.Channel) == "" {
+		bot.conf.Channels = append([]string{conf.Channel}, conf.Channels...)
+	}
+	if len(bot.conf.Channels) == 0 {
+		return nil, errors.New("no channels configured")
+	}
+
+	if err := bot.initPrefixes(); err != nil {
+		return nil, err
 	}
+	commands, err := newCommands(builtinCommands()...)
+	if err != nil {
+		return nil, err
+	}
+	bot.commands = commands
 
-	if bot.encoder == nil || bot.decoder == nil {
-		return nil, errors.Errorf("Unknown encoder or decoder for %q", conf.Encoding)
+	if err := bot.initRateLimits(); err != nil {
+		return nil, err
+	}
+	if err := bot.initVersions(); err != nil {
+		return nil, err
+	}
+	if err := bot.initAdmins(); err != nil {
+		return nil, err
+	}
+	if err := bot.initDaily(); err != nil {
+		return nil, err
+	}
+
+	if bot.conf.MaxAliasDepth == 0 {
+		bot.conf.MaxAliasDepth = defaultMaxAliasDepth
+	}
+
+	if len(bot.conf.Addresses) == 0 {
+		return nil, errors.New("no addresses configured")
+	}
+	if err := bot.initAuth(); err != nil {
+		return nil, err
+	}
+
+	if bot.conf.DialTimeout == 0 {
+		bot.conf.DialTimeout = defaultDialTimeout
+	}
+	if bot.conf.ReconnectMin == 0 {
+		bot.conf.ReconnectMin = defaultReconnectMin
+	}
+	if bot.conf.ReconnectMax == 0 {
+		bot.conf.ReconnectMax = defaultReconnectMax
+	}
+	if bot.conf.QuitMessage == "" {
+		bot.conf.QuitMessage = defaultQuitMessage
+	}
+	if bot.conf.StopTimeout == 0 {
+		bot.conf.StopTimeout = defaultStopTimeout
+	}
+	if bot.conf.FloodRate == 0 {
+		bot.conf.FloodRate = defaultFloodRate
+	}
+	if bot.conf.FloodBurst == 0 {
+		bot.conf.FloodBurst = defaultFloodBurst
+	}
+	if bot.conf.QueueSize == 0 {
+		bot.conf.QueueSize = defaultQueueSize
+	}
+	if bot.conf.MaxReplyLines == 0 {
+		bot.conf.MaxReplyLines = defaultMaxReplyLines
 	}
 
 	return bot, nil
 }
 
-const prefix = "!calc "
+const (
+	// how many trailing words of a missing key may be $args
+	argsWords = 5
+
+	defaultQuitMessage = "bye"
+	defaultStopTimeout = 10 * time.Second
+)
+
+// request is a command received in a channel or privately. The channel of a
+// private request is the namespace it was sent for.
+type request struct {
+	nick    string
+	channel string
+	user    string
+	host    string
+	// the services account of the nick if it is known
+	account string
+	when    time.Time
+	private bool
+	// the message was decoded from, replies are encoded to
+	charset *charset
+}
 
 func (b *Bot) Start() error {
-	log.Info("starting bot", log.Any("config", b.conf))
+	log.Info("starting bot", log.Any("config", b.conf.redacted()))
 
-	hijackSession := func(bot *hbot.Bot) {
-		bot.HijackSession = true
+	// the connection loop, the queue metrics, the rate limits cleanup, the
+	// lookups writer, the ignore list reload, the picks cleanup, the nick
+	// charsets cleanup and the calc of the day
+	workers := 7
+	if b.conf.CalcOfTheDay != "" {
+		workers++
 	}
+	b.refreshIgnores()
+	b.closer = worker.NewCloser(context.Background(), workers)
+	go b.run()
+	go worker.Worker(b.closer.Context, "queue "+b.conf.Nickname, queueStatsInterval, b.logQueueStats, nil, b.closer.WaitGroup)
+	go worker.Worker(b.closer.Context, "limits "+b.conf.Nickname, limitsCleanupInterval, b.limits.cleanup, nil, b.closer.WaitGroup)
+	go worker.Worker(b.closer.Context, "lookups "+b.conf.Nickname, lookupsFlushInterval, b.flushLookups, b.flushLookups, b.closer.WaitGroup)
+	go worker.Worker(b.closer.Context, "ignores "+b.conf.Nickname, ignoresReloadInterval, b.refreshIgnores, nil, b.closer.WaitGroup)
+	go worker.Worker(b.closer.Context, "picks "+b.conf.Nickname, picksCleanupInterval, b.cleanupPicks, nil, b.closer.WaitGroup)
+	go worker.Worker(b.closer.Context, "charsets "+b.conf.Nickname, nickCharsetsCleanupInterval, b.charsets.cleanup, nil, b.closer.WaitGroup)
+	if b.conf.CalcOfTheDay != "" {
+		go worker.Worker(b.closer.Context, "daily "+b.conf.Nickname, dailyCheckInterval, b.postCalcsOfTheDay, nil, b.closer.WaitGroup)
+	}
+
+	return nil
+}
+
+// newIRC creates a client for the session with the bot triggers.
+func (b *Bot) newIRC(s *session) (*hbot.Bot, error) {
 	channels := func(bot *hbot.Bot) {
-		bot.Channels = []string{b.conf.Channel}
+		bot.Channels = b.conf.Channels
+	}
+	dialer := func(bot *hbot.Bot) {
+		bot.Dial = s.dial(b.conf.DialTimeout)
+		bot.DialTLS = s.dialTLS(b.conf.DialTimeout)
+	}
+	secure := func(bot *hbot.Bot) {
+		if b.tlsConfig != nil {
+			bot.SSL = true
+			bot.TLSConfig = *b.tlsConfig.Clone()
+		}
+		// makes hellabot request the sasl capability before registration,
+		// the authentication itself is done by saslTrigger
+		bot.SASL = b.conf.SASL.Mechanism != ""
+	}
+	throttle := func(bot *hbot.Bot) {
+		// the session queue paces the messages
+		bot.ThrottleDelay = 0
 	}
-	bot, err := hbot.NewBot(b.conf.Addresses[0], b.conf.Nickname, hijackSession, channels)
+	// HijackSession is left off: a session taken over from a previous
+	// process is not registered again, so the registration is not detected
+	// and the bot does not identify nor track the accounts.
+	bot, err := hbot.NewBot(s.address, b.conf.Nickname, channels, dialer, secure, throttle)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	trigger := hbot.Trigger{
 		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
-			return strings.HasPrefix(m.Content, prefix)
-		},
-		Action: func(irc *hbot.Bot, m *hbot.Message) bool {
-			decodedFrom, err := b.decoder.String(m.From)
-			if err != nil {
-				irc.Reply(m, fmt.Sprintf("ERROR: %s", err))
+			if m.Command != "PRIVMSG" || b.ignoredSender(m) {
 				return false
 			}
-			decodedContent, err := b.decoder.String(m.Content)
-			if err != nil {
-				irc.Reply(m, fmt.Sprintf("ERROR: %s", err))
+			if isQuery(bot, m) {
+				return true
+			}
+			channel := b.channel(m.To)
+			if channel == "" {
 				return false
 			}
-			calc, err := b.getOrSetCalc(decodedFrom, m.TimeStamp, decodedContent)
+			content, err := b.charset.decode(m.Content)
 			if err != nil {
-				irc.Reply(m, fmt.Sprintf("ERROR: %s", err))
 				return false
 			}
-			encodedCalc, err := b.encoder.String(calc)
+			if strings.TrimSpace(content) == moreCommand {
+				nick, err := b.charset.decode(m.From)
+				return err == nil && b.more.has(nick, m.TimeStamp)
+			}
+			return strings.HasPrefix(content, b.prefix(channel))
+		},
+		Action: func(irc *hbot.Bot, m *hbot.Message) bool {
+			if !b.track() {
+				return true
+			}
+			defer b.handlers.Done()
+
+			req, err := b.serve(s, irc, m)
 			if err != nil {
-				irc.Reply(m, fmt.Sprintf("ERROR: %s", err))
+				if err := b.send(s, replyTarget(m), req.charset, fmt.Sprintf("ERROR: %s", err)); err != nil {
+					log.Error(err)
+				}
 				return false
 			}
-			irc.Reply(m, encodedCalc)
 			return true
 		}}
+	bot.AddTrigger(b.saslTrigger(s))
+	bot.AddTrigger(b.nickServTrigger(s))
+	bot.AddTrigger(b.members.trigger())
+	bot.AddTrigger(b.accountsTrigger(s))
 	bot.AddTrigger(trigger)
-	//bot.Logger.SetHandler(llog.LvlFilterHandler())
-	bot.Logger.SetHandler(llog.StreamHandler(os.Stdout, llog.JsonFormat()))
-	go bot.Run()
+	bot.Logger.SetHandler(ircLogHandler(os.Stdout))
 
-	return nil
+	return bot, nil
+}
+
+// ircLogHandler writes the hellabot logs. Debug records are dropped, they
+// include every line sent, the NickServ and SASL passwords too.
+func ircLogHandler(w io.Writer) llog.Handler {
+	return llog.LvlFilterHandler(llog.LvlInfo, llog.StreamHandler(w, llog.JsonFormat()))
+}
+
+// serve answers the message. hellabot runs the triggers in goroutines
+// without recovering them, a panic is logged and reported as an error
+// instead of crashing the bot.
+func (b *Bot) serve(s *session, irc *hbot.Bot, m *hbot.Message) (req request, reterr error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(errors.Errorf("panic: %v", r), log.String("from", m.From), log.String("content", m.Content))
+			reterr = errors.New("internal error")
+		}
+	}()
+
+	req, content, err := b.newRequest(irc, m)
+	if err != nil {
+		return req, err
+	}
+	return req, b.answer(s, m, req, content)
 }
 
+// newRequest decodes the message in the charset of the sender and returns the
+// request and the command.
+func (b *Bot) newRequest(irc *hbot.Bot, m *hbot.Message) (request, string, error) {
+	req := request{
+		channel: b.channel(m.To),
+		when:    m.TimeStamp,
+		charset: b.charset,
+	}
+	nick, err := b.charset.decode(m.From)
+	if err != nil {
+		return req, "", err
+	}
+	req.nick = nick
+	if m.Prefix != nil {
+		req.user, req.host = m.Prefix.User, m.Prefix.Host
+	}
+	req.account = b.accounts.get(m.From)
+	req.charset = b.charsetOf(req, m.Content)
+	content, err := req.charset.decode(m.Content)
+	if err != nil {
+		return req, "", err
+	}
+	more := strings.TrimSpace(content) == moreCommand
+	if isQuery(irc, m) {
+		req.private = true
+		req.channel, content, err = b.query(content)
+		if err != nil {
+			return req, "", err
+		}
+	}
+	if more {
+		content = b.prefix(req.channel) + nameMark + "more"
+	}
+	return req, content, nil
+}
+
+// answer handles the command of the request and replies.
+func (b *Bot) answer(s *session, m *hbot.Message, req request, content string) error {
+	calc, err := b.handle(req, content)
+	if err != nil || calc == "" {
+		return err
+	}
+	return b.reply(s, replyTarget(m), req, calc)
+}
+
+// Stop quits the server and waits for the connection loop and the command
+// handlers in flight to finish. The connection is dropped if the server does
+// not close it in time.
 func (b *Bot) Stop() error {
-	return nil
+	if b.closer == nil {
+		return nil
+	}
+	log.Info("stopping bot", log.String("nick", b.conf.Nickname))
+
+	b.stopMu.Lock()
+	b.stopped = true
+	b.stopMu.Unlock()
+
+	if s := b.currentSession(); s != nil {
+		quit, err := b.encoderFor(nil).String(b.conf.QuitMessage)
+		if err != nil {
+			log.Error(err)
+			quit = defaultQuitMessage
+		}
+		s.queue.pushControl("QUIT :" + quit)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.closer.Close()
+		b.handlers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("bot stopped", log.String("nick", b.conf.Nickname))
+		return nil
+	case <-time.After(b.conf.StopTimeout):
+	}
+
+	if s := b.currentSession(); s != nil {
+		s.fail(errors.New("stop timeout"))
+	}
+	select {
+	case <-done:
+		return errors.Errorf("%s: server did not close the connection in %s", b.conf.Nickname, b.conf.StopTimeout)
+	case <-time.After(b.conf.StopTimeout):
+		return errors.Errorf("%s: bot did not stop in %s", b.conf.Nickname, 2*b.conf.StopTimeout)
+	}
+}
+
+func (b *Bot) stopping() bool {
+	return b.closer.Context.Err() != nil
+}
+
+// track registers a command handler in flight, it reports false once the bot
+// is stopping. hellabot runs every message in its own goroutine.
+func (b *Bot) track() bool {
+	b.stopMu.Lock()
+	defer b.stopMu.Unlock()
+	if b.stopped {
+		return false
+	}
+	b.handlers.Add(1)
+	return true
 }
 
 var (
 	spaces   = regexp.MustCompile(`\s+`)
-	hasIndex = regexp.MustCompile(`\[(\d+)\]$`)
+	hasIndex = regexp.MustCompile(`\[(-?\d+|last|-?\d+\.\.-?\d+)\]$`)
 )
 
-func (b *Bot) getOrSetCalc(from string, when time.Time, data string) (string, error) {
+// channel returns the configured name of the channel or an empty string if
+// the bot does not serve it.
+func (b *Bot) channel(name string) string {
+	for _, channel := range b.conf.Channels {
+		if strings.EqualFold(channel, name) {
+			return channel
+		}
+	}
+	return ""
+}
+
+// fallbackChannel returns the global namespace the calcs missing in the
+// channel are looked up in, or an empty string if there is none.
+func (b *Bot) fallbackChannel(channel string) string {
+	if b.conf.Global == channel {
+		return ""
+	}
+	return b.conf.Global
+}
+
+func (b *Bot) getOrSetCalc(req request, data string) (string, error) {
 	parts := strings.SplitN(data, "=", 2)
 	if len(parts) > 1 {
-		return b.setCalc(from, when, parts)
+		if err := b.allowed(req, member); err != nil {
+			return "", err
+		}
+		return b.setCalc(req, parts[0], parts[1])
 	}
-	key := spaces.ReplaceAllString(data, " ")
-	index := hasIndex.FindAllStringSubmatch(key, 1)
-	if len(index) > 0 {
-		key = key[:len(key)-len(index[0][0])]
+	reply, key, hit, err := b.showCalc(req, data)
+	if err == nil && key != "" {
+		b.recordLookup(req, key, hit, false)
 	}
-	key = strings.TrimSpace(key[len(prefix):])
-	calcs, err := b.repo.GetCalcs(context.Background(), repository.GetCalcsParams{
-		Channel: b.conf.Channel,
-		Key:     key,
-	})
+	return reply, err
+}
+
+// showCalc shows the versions of the calc selected by the index. It returns
+// the key looked up and whether the calc exists too. The key is empty if the
+// reply is the result of an expression, it is not a lookup of a calc.
+func (b *Bot) showCalc(req request, data string) (string, string, bool, error) {
+	key, index := splitIndex(data)
+	if index == "" {
+		index = b.defaultIndex(req.channel)
+	}
+	newest, total, path, err := b.resolveCalc(req.channel, key)
 	if err != nil {
-		return fmt.Sprintf("ERROR %s", err), nil
+		return fmt.Sprintf("ERROR %s", err), key, false, nil
 	}
-	if len(calcs) == 0 {
-		return fmt.Sprintf("there is no calcs with %q", key), nil
+	var args string
+	if total == 0 {
+		newest, total, path, args, err = b.resolveCalcWithArgs(req.channel, key, index)
+		if err != nil {
+			return fmt.Sprintf("ERROR %s", err), key, false, nil
+		}
 	}
-	if len(index) > 0 {
-		return b.getCalcByIndex(index[0][1], calcs)
+	if total == 0 {
+		reply, evaluated := b.missingReply(req.channel, key, path)
+		if evaluated {
+			return reply, "", false, nil
+		}
+		return reply, key, false, nil
 	}
-	return b.getCalcByIndex("0", calcs)
+	picked, first, err := b.calcVersions(newest, total, index)
+	if err != nil {
+		return "", key, false, err
+	}
+	replies := make([]string, 0, len(picked))
+	for i, c := range picked {
+		c.Content, err = b.expandRefs(req.channel, c.Key, c.Content)
+		if err != nil {
+			return "", key, false, err
+		}
+		c.Content = expandTemplate(c.Content, templateVars{
+			Nick:    req.nick,
+			Channel: req.channel,
+			When:    req.when,
+			Args:    args,
+			RandomNick: func() string {
+				nick, _ := b.charset.decode(b.members.random(req.channel))
+				return nick
+			},
+		})
+		replies = append(replies, formatCalc(c.Key, c.Content, c.By, c.When)+position(first+i, total))
+	}
+	return strings.Join(replies, "\n") + redirectFooter(path), path[0], true, nil
 }
 
-func (b *Bot) getCalcByIndex(index string, calcs []repository.IrcCalc) (string, error) {
-	num, err := strconv.ParseUint(index, 10, 64)
-	if err != nil {
-		return "", err
+// missingReply is the reply for a key no calc was found for following the
+// aliases in the path. A key which is not an alias of another one is
+// evaluated if it is an expression, it reports whether it was.
+func (b *Bot) missingReply(channel, key string, path []string) (string, bool) {
+	if len(path) == 1 {
+		if result, ok := evalMissing(key); ok {
+			return result, true
+		}
 	}
-	if int(num) > len(calcs)-1 {
-		return "", errors.Errorf("calc index %d out of range, max %d", num, len(calcs)-1)
+	return b.missingCalc(channel, path[len(path)-1]) + redirectFooter(path), false
+}
+
+// resolveCalcWithArgs looks for a calc using $args among the keys made of
+// the leading words of the key, longest first. The rest of the words are the
+// args.
+func (b *Bot) resolveCalcWithArgs(channel, key, index string) (repository.IrcCalc, int, []string, string, error) {
+	words := strings.Split(key, " ")
+	for n := len(words) - 1; n > 0 && len(words)-n <= argsWords; n-- {
+		newest, total, path, err := b.resolveCalc(channel, strings.Join(words[:n], " "))
+		if err != nil {
+			return newest, 0, path, "", err
+		}
+		if total == 0 {
+			continue
+		}
+		if picked, _, err := b.calcVersions(newest, total, index); err == nil && usesArgs(picked[0].Content) {
+			return newest, total, path, strings.Join(words[n:], " "), nil
+		}
 	}
-	c := calcs[num]
-	if err != nil {
-		return "", err
+	return repository.IrcCalc{}, 0, []string{key}, "", nil
+}
+
+// splitIndex normalizes spaces in data and cuts the trailing [n], [-n],
+// [last] or [a..b] index off the key. The index is empty if there is none.
+func splitIndex(data string) (key, index string) {
+	key = spaces.ReplaceAllString(data, " ")
+	match := hasIndex.FindAllStringSubmatch(key, 1)
+	if len(match) > 0 {
+		key = key[:len(key)-len(match[0][0])]
+		index = match[0][1]
 	}
-	return fmt.Sprintf("%s = %s [%s, %s]", c.Key, c.Content, c.By, formatTime(c.When)), nil
+	return strings.TrimSpace(key), index
 }
 
-func (b *Bot) setCalc(by string, when time.Time, data []string) (string, error) {
-	key := spaces.ReplaceAllString(data[0], " ")
-	key = strings.TrimSpace(key[len(prefix):])
-	content := spaces.ReplaceAllString(data[1], " ")
-	content = strings.TrimSpace(content)
+func (b *Bot) setCalc(req request, key, content string) (string, error) {
+	key = strings.TrimSpace(spaces.ReplaceAllString(key, " "))
+	content = strings.TrimSpace(spaces.ReplaceAllString(content, " "))
+	if target, ok := aliasTarget(content); ok {
+		if err := b.checkAlias(req.channel, key, target); err != nil {
+			return "", err
+		}
+	}
 	params := repository.AddCalcParams{
-		Channel: b.conf.Channel,
+		Channel: req.channel,
 		Key:     key,
-		By:      by,
-		When:    when.UTC(),
+		NormKey: b.normKey(key),
+		By:      req.nick,
+		When:    req.when.UTC(),
 		Content: content,
 	}
 	if _, err := b.repo.AddCalc(context.Background(), params); err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s = %s [%s, %s]", key, content, by, formatTime(when)), nil
+	b.recordLookup(req, key, true, true)
+	return formatCalc(key, content, req.nick, req.when), nil
+}
+
+// normKey returns the form the key is matched by.
+func (b *Bot) normKey(key string) string {
+	return repository.NormalizeKey(key, b.conf.FoldYo)
+}
+
+// KeyNormalizer returns how the keys of a channel are normalized by the bot
+// serving it, the channels no bot serves get the defaults.
+func KeyNormalizer(confs []Config) func(channel, key string) string {
+	foldYo := map[string]bool{}
+	for _, conf := range confs {
+		for _, channel := range append([]string{conf.Channel, conf.Global}, conf.Channels...) {
+			if channel != "" {
+				foldYo[strings.ToLower(channel)] = conf.FoldYo
+			}
+		}
+	}
+	return func(channel, key string) string {
+		return repository.NormalizeKey(key, foldYo[strings.ToLower(channel)])
+	}
+}
+
+// msg encodes the text in the charset and sends it to the nick or channel.
+func (b *Bot) msg(who string, cs *charset, text string) error {
+	s := b.currentSession()
+	if s == nil {
+		return errors.New("not connected")
+	}
+	return b.send(s, who, cs, text)
+}
+
+func formatCalc(key, content, by string, when time.Time) string {
+	return fmt.Sprintf("%s = %s [%s, %s]", key, calcText(content), by, formatTime(when))
 }
 
 func formatTime(t time.Time) string {
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	hbot "github.com/whyrusleeping/hellabot"
+	llog "gopkg.in/inconshreveable/log15.v2"
+)
+
+func TestSplitIndex(t *testing.T) {
+	key, index := splitIndex("  some   key [12]")
+	assert.Equal(t, "some key", key)
+	assert.Equal(t, "12", index)
+
+	key, index = splitIndex("some key[3]")
+	assert.Equal(t, "some key", key)
+	assert.Equal(t, "3", index)
+
+	key, index = splitIndex("some [key] ")
+	assert.Equal(t, "some [key]", key)
+	assert.Equal(t, "", index)
+
+	for data, want := range map[string]string{
+		"key[-1]":    "-1",
+		"key[last]":  "last",
+		"key[1..3]":  "1..3",
+		"key[0..-2]": "0..-2",
+		"key[1..]":   "",
+		"key[-]":     "",
+	} {
+		_, index = splitIndex(data)
+		assert.Equal(t, want, index, data)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "привет ...", truncate("привет мир, как дела", 10))
+}
+
+func TestAliasTarget(t *testing.T) {
+	target, ok := aliasTarget("@ nginx ")
+	assert.True(t, ok)
+	assert.Equal(t, "nginx", target)
+
+	_, ok = aliasTarget("@")
+	assert.False(t, ok)
+
+	_, ok = aliasTarget("mail me at user@host")
+	assert.False(t, ok)
+
+	_, ok = aliasTarget("@@here at 5")
+	assert.False(t, ok)
+	assert.Equal(t, "@here at 5", calcText("@@here at 5"))
+	assert.Equal(t, "@nginx", calcText("@nginx"))
+	assert.Equal(t, "meeting = @here at 5 [user, Monday, 01-Jan-24 00:00:00 UTC]",
+		formatCalc("meeting", "@@here at 5", "user", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestRedirectFooter(t *testing.T) {
+	assert.Equal(t, "", redirectFooter([]string{"a"}))
+	assert.Equal(t, " (redirected from a -> b)", redirectFooter([]string{"a", "b", "c"}))
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	normalize := KeyNormalizer([]Config{
+		{Channels: []string{"#yo"}, FoldYo: true},
+		{Channel: "#plain", Global: "*"},
+	})
+	assert.Equal(t, "елка", normalize("#YO", " Ёлка "))
+	assert.Equal(t, "ёлка", normalize("#plain", "Ёлка"))
+	assert.Equal(t, "ёлка", normalize("#unknown", "Ёлка"))
+}
+
+func TestChannel(t *testing.T) {
+	b, err := NewBot(Config{
+		Channel:   "#Main",
+		Channels:  []string{"#test"},
+		Global:    "*",
+		Nickname:  "calc",
+		Addresses: []string{"localhost:6667"},
+		Encoding:  "utf-8",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#Main", b.channel("#main"))
+	assert.Equal(t, "#test", b.channel("#TEST"))
+	assert.Equal(t, "", b.channel("#other"))
+	assert.Equal(t, "", b.channel("*"))
+
+	// queries without a channel go to the first one
+	channel, _, err := b.query("key")
+	require.NoError(t, err)
+	assert.Equal(t, "#Main", channel)
+
+	assert.Equal(t, "*", b.fallbackChannel("#Main"))
+	assert.Equal(t, "", b.fallbackChannel("*"))
+	b.conf.Global = ""
+	assert.Equal(t, "", b.fallbackChannel("#Main"))
+}
+
+func TestMissingReply(t *testing.T) {
+	b := newCommandsBot(t)
+
+	// the results of expressions are not lookups, they are not counted as
+	// missing calcs in the stats
+	reply, evaluated := b.missingReply("#test", "2+2", []string{"2+2"})
+	assert.True(t, evaluated)
+	assert.Equal(t, "2+2 = 4", reply)
+
+	reply, evaluated = b.missingReply("#test", "foo", []string{"foo"})
+	assert.False(t, evaluated)
+	assert.Equal(t, `there is no calcs with "foo"`, reply)
+
+	// the target of an alias is never evaluated
+	reply, evaluated = b.missingReply("#test", "sum", []string{"sum", "2+2"})
+	assert.False(t, evaluated)
+	assert.Equal(t, `there is no calcs with "2+2" (redirected from sum)`, reply)
+}
+
+func TestServeRecovers(t *testing.T) {
+	b := newCommandsBot(t)
+	// there is no client to tell queries from channel messages
+	_, err := b.serve(nil, nil, hbot.ParseMessage(":user!u@h PRIVMSG #test :!calc key"))
+	assert.EqualError(t, err, "internal error")
+}
+
+func TestIRCLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := llog.New()
+	logger.SetHandler(ircLogHandler(&buf))
+	logger.Debug("Outgoing", "data", "PRIVMSG NickServ :IDENTIFY secret")
+	logger.Info("Connected successfully!")
+	assert.NotContains(t, buf.String(), "secret")
+	assert.Contains(t, buf.String(), "Connected successfully!")
+}
@@ -0,0 +1,336 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	xunicode "golang.org/x/text/encoding/unicode"
+
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	// penalties of the detection for unlikely text
+	caseChangePenalty = 50
+	nonLetterPenalty  = 100
+
+	// a failed load of the charset of a nick is retried after this
+	charsetRetryInterval = time.Minute
+	// the nicks not seen for this long are forgotten, the nicks beyond the
+	// maximum are not remembered until then
+	nickCharsetsTTL             = 24 * time.Hour
+	nickCharsetsCleanupInterval = time.Hour
+	maxNickCharsets             = 10000
+)
+
+type charset struct {
+	name     string
+	encoding encoding.Encoding
+}
+
+func (cs *charset) encode(text string) (string, error) {
+	return cs.encoding.NewEncoder().String(text)
+}
+
+func (cs *charset) decode(data string) (string, error) {
+	return cs.encoding.NewDecoder().String(data)
+}
+
+var (
+	utf8Charset = &charset{name: "utf-8", encoding: xunicode.UTF8}
+
+	// single byte charsets the detection chooses from
+	singleByteCharsets = []*charset{
+		{name: "windows-1251", encoding: charmap.Windows1251},
+		{name: "koi8-r", encoding: charmap.KOI8R},
+		{name: "iso-8859-5", encoding: charmap.ISO8859_5},
+		{name: "cp866", encoding: charmap.CodePage866},
+	}
+
+	charsetAliases = map[string]string{
+		"utf8":     "utf-8",
+		"cp1251":   "windows-1251",
+		"koi8r":    "koi8-r",
+		"iso88595": "iso-8859-5",
+		"ibm866":   "cp866",
+	}
+
+	// frequencies of the russian letters, per mille
+	letterWeights = map[rune]int{
+		'о': 110, 'е': 85, 'а': 80, 'и': 74, 'н': 67, 'т': 63, 'с': 55, 'р': 47,
+		'в': 45, 'л': 44, 'к': 35, 'м': 32, 'д': 30, 'п': 28, 'у': 26, 'я': 20,
+		'ы': 19, 'ь': 17, 'г': 17, 'з': 16, 'б': 16, 'ч': 14, 'й': 12, 'х': 10,
+		'ж': 9, 'ш': 7, 'ю': 6, 'ц': 5, 'щ': 4, 'э': 3, 'ф': 3, 'ъ': 1, 'ё': 1,
+	}
+)
+
+// lookupCharset returns the charset by its name or alias, nil if unknown.
+func lookupCharset(name string) *charset {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := charsetAliases[name]; ok {
+		name = alias
+	}
+	if name == utf8Charset.name {
+		return utf8Charset
+	}
+	for _, cs := range singleByteCharsets {
+		if cs.name == name {
+			return cs
+		}
+	}
+	return nil
+}
+
+func charsetNames() string {
+	names := []string{utf8Charset.name}
+	for _, cs := range singleByteCharsets {
+		names = append(names, cs.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// detectCharset guesses the charset of the data, nil if it is plain ASCII.
+// Valid UTF-8 is taken as is, otherwise the single byte charset decoding the
+// data into the most russian-looking text wins, fallback wins the ties.
+func detectCharset(data string, fallback *charset) *charset {
+	ascii := true
+	for i := 0; i < len(data); i++ {
+		if data[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return nil
+	}
+	if utf8.ValidString(data) {
+		return utf8Charset
+	}
+
+	var best *charset
+	bestScore := 0
+	candidates := singleByteCharsets
+	if fallback != nil && fallback != utf8Charset {
+		candidates = append([]*charset{fallback}, candidates...)
+	}
+	for _, cs := range candidates {
+		text, err := cs.decode(data)
+		if err != nil {
+			continue
+		}
+		if score := russianScore(text); best == nil || score > bestScore {
+			best, bestScore = cs, score
+		}
+	}
+	return best
+}
+
+// russianScore sums the frequencies of the letters. Upper case letters after
+// lower case ones and non-ASCII symbols other than russian letters are
+// penalized.
+func russianScore(text string) int {
+	score := 0
+	lower := false
+	for _, r := range text {
+		weight, ok := letterWeights[unicode.ToLower(r)]
+		switch {
+		case ok:
+			score += weight
+			if unicode.IsUpper(r) && lower {
+				score -= caseChangePenalty
+			}
+		case r >= utf8.RuneSelf:
+			score -= nonLetterPenalty
+		}
+		lower = unicode.IsLower(r)
+	}
+	return score
+}
+
+// nickCharset is the charset set by the nick, loaded from the database once,
+// and the last one detected from the messages of the nick.
+type nickCharset struct {
+	loaded   bool
+	override *charset
+	learned  *charset
+	// when the load failed last and when the nick was seen last
+	failed time.Time
+	seen   time.Time
+}
+
+type nickCharsets struct {
+	mu     sync.Mutex
+	byNick map[string]*nickCharset
+}
+
+func newNickCharsets() *nickCharsets {
+	return &nickCharsets{
+		byNick: map[string]*nickCharset{},
+	}
+}
+
+// get returns the charsets of the nick, the override is loaded with load if
+// it has not been yet. A failed load is not retried for a while, nothing is
+// loaded without load or when too many nicks are remembered.
+func (nc *nickCharsets) get(nick string, now time.Time, load func(nick string) (*charset, error)) (nickCharset, error) {
+	nick = strings.ToLower(nick)
+	nc.mu.Lock()
+	c, ok := nc.byNick[nick]
+	if !ok {
+		if len(nc.byNick) >= maxNickCharsets {
+			nc.mu.Unlock()
+			return nickCharset{}, nil
+		}
+		c = &nickCharset{}
+		nc.byNick[nick] = c
+	}
+	c.seen = now
+	retry := load != nil && !c.loaded && now.Sub(c.failed) >= charsetRetryInterval
+	nc.mu.Unlock()
+
+	var err error
+	if retry {
+		var override *charset
+		override, err = load(nick)
+		nc.mu.Lock()
+		if err != nil {
+			c.failed = now
+		} else {
+			c.loaded, c.override = true, override
+		}
+		nc.mu.Unlock()
+	}
+
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	return *c, err
+}
+
+func (nc *nickCharsets) learn(nick string, cs *charset) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nick = strings.ToLower(nick)
+	if c, ok := nc.byNick[nick]; ok {
+		c.learned = cs
+		return
+	}
+	if len(nc.byNick) < maxNickCharsets {
+		nc.byNick[nick] = &nickCharset{learned: cs, seen: time.Now()}
+	}
+}
+
+func (nc *nickCharsets) override(nick string, cs *charset) {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	nick = strings.ToLower(nick)
+	c, ok := nc.byNick[nick]
+	if !ok {
+		c = &nickCharset{}
+		nc.byNick[nick] = c
+	}
+	c.loaded, c.override, c.seen = true, cs, time.Now()
+}
+
+// cleanup forgets the nicks not seen for nickCharsetsTTL.
+func (nc *nickCharsets) cleanup() {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+	now := time.Now()
+	for nick, c := range nc.byNick {
+		if now.Sub(c.seen) > nickCharsetsTTL {
+			delete(nc.byNick, nick)
+		}
+	}
+}
+
+// loadCharset reads the charset set by the nick from the database.
+func (b *Bot) loadCharset(nick string) (*charset, error) {
+	name, err := b.repo.GetNickEncoding(context.Background(), nick)
+	if err != nil || name == "" {
+		return nil, err
+	}
+	cs := lookupCharset(name)
+	if cs == nil {
+		log.Info("unknown nick encoding", log.String("nick", nick), log.String("encoding", name))
+	}
+	return cs, nil
+}
+
+// charsetOf returns the charset to decode the data from the sender of the
+// request and to reply in: the one set by the nick, the detected one, the
+// last one detected from the nick or the default one. The charset set is not
+// loaded for the senders ignored or out of requests, they are not answered.
+func (b *Bot) charsetOf(req request, data string) *charset {
+	nick := req.nick
+	load := b.loadCharset
+	if b.limits.isIgnored(req, req.when) || b.limits.exhausted(req, req.when) {
+		load = nil
+	}
+	c, err := b.charsets.get(nick, req.when, load)
+	if err != nil {
+		log.Error(err, log.String("nick", nick))
+	}
+	if c.override != nil {
+		return c.override
+	}
+	if cs := detectCharset(data, b.charset); cs != nil {
+		b.charsets.learn(nick, cs)
+		return cs
+	}
+	if c.learned != nil {
+		return c.learned
+	}
+	return b.charset
+}
+
+// encodingCommand shows the charset used for the nick, sets it or lets it be
+// detected again with "auto".
+func (b *Bot) encodingCommand(req request, data string) (string, error) {
+	name := strings.TrimSpace(data)
+	nick := strings.ToLower(req.nick)
+	switch name {
+	case "":
+		c, err := b.charsets.get(nick, req.when, b.loadCharset)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c.override != nil:
+			return fmt.Sprintf("%s: %s, set by you", req.nick, c.override.name), nil
+		case c.learned != nil:
+			return fmt.Sprintf("%s: %s, detected", req.nick, c.learned.name), nil
+		default:
+			return fmt.Sprintf("%s: %s, default", req.nick, b.charset.name), nil
+		}
+	case "auto":
+		if _, err := b.repo.DeleteNickEncoding(context.Background(), nick); err != nil {
+			return "", err
+		}
+		b.charsets.override(nick, nil)
+		return fmt.Sprintf("%s: encoding is detected", req.nick), nil
+	}
+
+	cs := lookupCharset(name)
+	if cs == nil {
+		return "", errors.Errorf("unknown encoding %q, known: %s", name, charsetNames())
+	}
+	err := b.repo.SetNickEncoding(context.Background(), repository.SetNickEncodingParams{
+		Nick:     nick,
+		Encoding: cs.name,
+		When:     req.when.UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	b.charsets.override(nick, cs)
+	return fmt.Sprintf("%s: encoding set to %s", req.nick, cs.name), nil
+}
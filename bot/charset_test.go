@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupCharset(t *testing.T) {
+	for name, want := range map[string]string{
+		"utf-8":        "utf-8",
+		"UTF8":         "utf-8",
+		"cp1251":       "windows-1251",
+		"Windows-1251": "windows-1251",
+		"koi8r":        "koi8-r",
+		"iso-8859-5":   "iso-8859-5",
+		"ibm866":       "cp866",
+		"latin1":       "",
+	} {
+		cs := lookupCharset(name)
+		if want == "" {
+			assert.Nil(t, cs, name)
+			continue
+		}
+		require.NotNil(t, cs, name)
+		assert.Equal(t, want, cs.name, name)
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	koi8r := lookupCharset("koi8-r")
+
+	assert.Nil(t, detectCharset("plain ascii", koi8r))
+	assert.Equal(t, "utf-8", detectCharset("привет, мир", koi8r).name)
+
+	for _, text := range []string{
+		"привет, как дела?",
+		"ПРИВЕТ",
+		"Сегодня Хорошая Погода",
+		"ок",
+	} {
+		for _, name := range []string{"windows-1251", "koi8-r", "cp866", "iso-8859-5"} {
+			cs := lookupCharset(name)
+			data, err := cs.encode(text)
+			require.NoError(t, err)
+			detected := detectCharset(data, koi8r)
+			require.NotNil(t, detected, text)
+			assert.Equal(t, name, detected.name, text)
+		}
+	}
+}
+
+func TestCharsetOf(t *testing.T) {
+	b := newCommandsBot(t)
+	b.charsets.override("fixed", lookupCharset("cp866"))
+	b.charsets.override("user", nil)
+
+	cp1251, err := lookupCharset("windows-1251").encode("привет")
+	require.NoError(t, err)
+
+	now := time.Now()
+	fixed := request{nick: "Fixed", channel: "#test", when: now}
+	user := request{nick: "user", channel: "#test", when: now}
+	assert.Equal(t, "cp866", b.charsetOf(fixed, cp1251).name)
+	assert.Equal(t, "koi8-r", b.charsetOf(user, "hi").name)
+	assert.Equal(t, "windows-1251", b.charsetOf(user, cp1251).name)
+	// ASCII messages are answered in the encoding learned
+	user.nick = "USER"
+	assert.Equal(t, "windows-1251", b.charsetOf(user, "hi").name)
+}
+
+func TestNickCharsets(t *testing.T) {
+	nc := newNickCharsets()
+	now := time.Now()
+	loads := 0
+	failing := func(string) (*charset, error) {
+		loads++
+		return nil, errors.New("no database")
+	}
+
+	// a failed load is retried after a while
+	_, err := nc.get("user", now, failing)
+	assert.Error(t, err)
+	_, err = nc.get("User", now.Add(time.Second), failing)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, loads)
+	_, err = nc.get("user", now.Add(charsetRetryInterval), failing)
+	assert.Error(t, err)
+	assert.Equal(t, 2, loads)
+
+	// nothing is loaded without a loader
+	c, err := nc.get("other", now, nil)
+	assert.NoError(t, err)
+	assert.False(t, c.loaded)
+
+	// old nicks are forgotten
+	nc.byNick["user"].seen = time.Now().Add(-nickCharsetsTTL - time.Minute)
+	nc.cleanup()
+	assert.NotContains(t, nc.byNick, "user")
+	assert.Contains(t, nc.byNick, "other")
+
+	// no more nicks are remembered beyond the maximum
+	koi8r := lookupCharset("koi8-r")
+	for i := len(nc.byNick); i < maxNickCharsets; i++ {
+		nc.learn(fmt.Sprintf("nick%d", i), koi8r)
+	}
+	nc.learn("new", koi8r)
+	_, err = nc.get("newer", now, failing)
+	assert.NoError(t, err)
+	assert.Len(t, nc.byNick, maxNickCharsets)
+	assert.Equal(t, 2, loads)
+}
+
+func TestCharsetOfLimited(t *testing.T) {
+	b := newCommandsBot(t)
+	now := time.Now()
+	req := request{nick: "user", host: "host", channel: "#test", when: now}
+	conf := RateLimitConfig{Reads: 1, Writes: 1, Period: time.Minute, IgnoreAfter: 3, IgnoreFor: time.Hour}
+	assert.Equal(t, allowed, b.limits.check(conf, req, false, now))
+
+	// the database of the test bot is not there, the load is not tried
+	b.charsetOf(req, "hi")
+	c, err := b.charsets.get("user", now, nil)
+	require.NoError(t, err)
+	assert.True(t, c.failed.IsZero())
+}
@@ -0,0 +1,364 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPrefix = "!calc"
+	// separates the prefix and the name of a command: "!calc-history"
+	nameMark = "-"
+)
+
+// permission is who may run a command.
+type permission int
+
+const (
+	anyone permission = iota
+	// private requests are allowed for the nicks present in the channel
+	member
+	adminOnly
+)
+
+// command is a bot command. The command with the empty name is run by the
+// bare prefix: "!calc key".
+type command struct {
+	name    string
+	aliases []string
+	// arguments shown in the help, the command is not run without them if
+	// needArgs is set
+	usage    string
+	needArgs bool
+	help     string
+	perm     permission
+	handler  func(b *Bot, req request, args string) (string, error)
+}
+
+// builtinCommands returns the commands of the bot in the order they are
+// listed in the help.
+func builtinCommands() []*command {
+	return []*command{
+		{
+			usage:    "<key>[[n]] | <key> = <content>",
+			needArgs: true,
+			help:     "shows the calc, its n-th version ([-1] or [last] is the newest) or a range [1..3], sets it with =, content starting with @ makes an alias, @@ starts it with a plain @",
+			handler:  (*Bot).getOrSetCalc,
+		},
+		{
+			name:    "more",
+			help:    "continues the last long reply, " + moreCommand + " works too",
+			handler: (*Bot).moreReply,
+		},
+		{
+			name:     "alias",
+			usage:    "<key> = <target>",
+			needArgs: true,
+			help:     "makes the key show the target calc",
+			perm:     member,
+			handler:  (*Bot).aliasCalc,
+		},
+		{
+			name:     "history",
+			aliases:  []string{"hist"},
+			usage:    "<key>",
+			needArgs: true,
+			help:     "lists the latest versions of the calc",
+			handler:  (*Bot).calcHistory,
+		},
+		{
+			name:     "revert",
+			usage:    "<key>[[n]]",
+			needArgs: true,
+			help:     "makes the n-th or the previous version the latest one",
+			perm:     member,
+			handler:  (*Bot).revertCalc,
+		},
+		{
+			name:     "forget",
+			aliases:  []string{"rm"},
+			usage:    "<key>[[n]]",
+			needArgs: true,
+			help:     "deletes the n-th, a range or every version of the calc",
+			perm:     member,
+			handler:  (*Bot).forgetCalc,
+		},
+		{
+			name:     "undelete",
+			usage:    "<key>[[n]]",
+			needArgs: true,
+			help:     "restores the n-th or every deleted version of the calc",
+			perm:     member,
+			handler:  (*Bot).undeleteCalc,
+		},
+		{
+			name:     "search",
+			aliases:  []string{"find"},
+			usage:    "<pattern>",
+			needArgs: true,
+			help:     "lists the keys closest to the pattern",
+			handler:  (*Bot).searchCalcs,
+		},
+		{
+			name:     "grep",
+			usage:    "<words>",
+			needArgs: true,
+			help:     "finds calcs by their content",
+			handler:  (*Bot).grepCalcs,
+		},
+		{
+			name:    "random",
+			usage:   "[pattern]",
+			help:    "shows a random calc, its key containing the pattern if there is one",
+			handler: (*Bot).randomCalc,
+		},
+		{
+			name:     "eval",
+			usage:    "<expression>",
+			needArgs: true,
+			help:     "calculates the expression, units are converted with \"in\"",
+			handler:  (*Bot).evalExpression,
+		},
+		{
+			name:    "encoding",
+			usage:   "[name|auto]",
+			help:    "shows or sets the encoding of your messages, auto detects it again",
+			handler: (*Bot).encodingCommand,
+		},
+		{
+			name:    "stats",
+			help:    "shows the number of keys, the most looked up ones, the top contributors and the missing keys asked for the most",
+			handler: (*Bot).statsCommand,
+		},
+		{
+			name:    "audit",
+			help:    "shows the latest deletes and restores",
+			perm:    adminOnly,
+			handler: (*Bot).calcAudit,
+		},
+		{
+			name:    "limits",
+			usage:   "[clear <nick|host|all>]",
+			help:    "lists the nicks and hosts ignored for flooding or stops ignoring them",
+			perm:    adminOnly,
+			handler: (*Bot).limitsCommand,
+		},
+		{
+			name:    "ignore",
+			usage:   "[<nick!user@host|$a:account> [readonly]]",
+			help:    "lists the ignore list or stops answering the mask, readonly ones may still look calcs up",
+			perm:    adminOnly,
+			handler: (*Bot).ignoreCommand,
+		},
+		{
+			name:     "unignore",
+			usage:    "<nick!user@host|$a:account>",
+			needArgs: true,
+			help:     "removes the mask from the ignore list",
+			perm:     adminOnly,
+			handler:  (*Bot).unignoreCommand,
+		},
+		{
+			name:    "help",
+			usage:   "[command]",
+			help:    "lists the commands or describes one",
+			handler: (*Bot).commandHelp,
+		},
+	}
+}
+
+// commands is the registry of the bot commands by their names and aliases.
+type commands struct {
+	list   []*command
+	byName map[string]*command
+}
+
+func newCommands(list ...*command) (*commands, error) {
+	c := &commands{
+		byName: map[string]*command{},
+	}
+	for _, cmd := range list {
+		if err := c.register(cmd); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// writes reports whether the command changes calcs, these are rate limited
+// separately.
+func (cmd *command) writes(args string) bool {
+	return cmd.perm == member || (cmd.name == "" && strings.Contains(args, "="))
+}
+
+func (c *commands) register(cmd *command) error {
+	for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+		if _, ok := c.byName[name]; ok {
+			return errors.Errorf("command %q is already registered", name)
+		}
+		c.byName[name] = cmd
+	}
+	c.list = append(c.list, cmd)
+	return nil
+}
+
+func (c *commands) lookup(name string) *command {
+	return c.byName[strings.ToLower(name)]
+}
+
+// parseCommand splits the message into the name of the command and its
+// arguments. It reports false if the message does not start with the prefix.
+func parseCommand(prefix, data string) (name, args string, ok bool) {
+	if !strings.HasPrefix(data, prefix) {
+		return "", "", false
+	}
+	rest := data[len(prefix):]
+	switch {
+	case rest == "":
+		return "", "", true
+	case strings.HasPrefix(rest, " "):
+		return "", rest[1:], true
+	case strings.HasPrefix(rest, nameMark):
+		parts := strings.SplitN(rest[len(nameMark):], " ", 2)
+		if len(parts) > 1 {
+			args = parts[1]
+		}
+		return parts[0], args, parts[0] != ""
+	}
+	return "", "", false
+}
+
+// prefix returns the command prefix of the channel.
+func (b *Bot) prefix(channel string) string {
+	for name, prefix := range b.conf.Prefixes {
+		if strings.EqualFold(name, channel) {
+			return prefix
+		}
+	}
+	return b.conf.Prefix
+}
+
+// initPrefixes checks the configured prefixes.
+func (b *Bot) initPrefixes() error {
+	if b.conf.Prefix == "" {
+		b.conf.Prefix = defaultPrefix
+	}
+	prefixes := map[string]string{"": b.conf.Prefix}
+	for channel, prefix := range b.conf.Prefixes {
+		if b.channel(channel) == "" {
+			return errors.Errorf("prefix %q for unknown channel %q", prefix, channel)
+		}
+		prefixes[channel] = prefix
+	}
+	for channel, prefix := range prefixes {
+		if prefix == "" || strings.ContainsAny(prefix, " \t") {
+			return errors.Errorf("invalid prefix %q for channel %q", prefix, channel)
+		}
+	}
+	return nil
+}
+
+// handle runs the command of the message. Messages which are not commands
+// are ignored.
+func (b *Bot) handle(req request, data string) (string, error) {
+	name, args, ok := parseCommand(b.prefix(req.channel), data)
+	if !ok {
+		return "", nil
+	}
+	cmd := b.commands.lookup(name)
+	if cmd == nil || b.limits.isIgnored(req, req.when) {
+		return "", nil
+	}
+	switch b.limit(req, cmd, args) {
+	case limited:
+		return fmt.Sprintf("%s: too many requests, slow down", req.nick), nil
+	case silenced:
+		return "", nil
+	}
+	if err := b.allowed(req, cmd.perm); err != nil {
+		return "", err
+	}
+	if cmd.writes(args) {
+		if entry := b.ignoreOf(req); entry != nil {
+			return "", errors.Errorf("%s may not change calcs", req.nick)
+		}
+	}
+	if cmd.needArgs && strings.TrimSpace(args) == "" {
+		return "usage: " + b.usage(req.channel, cmd), nil
+	}
+	return cmd.handler(b, req, args)
+}
+
+// allowed checks the permission of the nick for the request. Admins are
+// allowed everything.
+func (b *Bot) allowed(req request, perm permission) error {
+	if perm == anyone || b.isAdmin(req) {
+		return nil
+	}
+	switch perm {
+	case member:
+		if b.conf.Global != "" && req.channel == b.conf.Global {
+			return errors.Errorf("%s is not an admin, only admins change %s", req.nick, req.channel)
+		}
+		if req.private && !b.isMember(req.channel, req.nick) {
+			return errors.Errorf("%s is not in %s", req.nick, req.channel)
+		}
+		return nil
+	default:
+		return errors.Errorf("%s is not an admin", req.nick)
+	}
+}
+
+// usage returns the command line of the command in the channel.
+func (b *Bot) usage(channel string, cmd *command) string {
+	line := b.commandName(channel, cmd)
+	if cmd.usage != "" {
+		line += " " + cmd.usage
+	}
+	return line
+}
+
+func (b *Bot) commandName(channel string, cmd *command) string {
+	if cmd.name == "" {
+		return b.prefix(channel)
+	}
+	return b.prefix(channel) + nameMark + cmd.name
+}
+
+// commandHelp lists the commands of the registry or describes the one given:
+// "!calc-help history".
+func (b *Bot) commandHelp(req request, data string) (string, error) {
+	prefix := b.prefix(req.channel)
+	name := strings.TrimSpace(data)
+	if name == "" {
+		names := make([]string, 0, len(b.commands.list))
+		for _, cmd := range b.commands.list {
+			if cmd.name == "" {
+				continue
+			}
+			names = append(names, b.commandName(req.channel, cmd))
+		}
+		return fmt.Sprintf("usage: %s | commands: %s | %s%shelp <command> for details",
+			b.usage(req.channel, b.commands.lookup("")), strings.Join(names, ", "), prefix, nameMark), nil
+	}
+
+	name = strings.TrimPrefix(strings.TrimPrefix(name, prefix), nameMark)
+	cmd := b.commands.lookup(name)
+	if cmd == nil {
+		return fmt.Sprintf("unknown command %q", data), nil
+	}
+	help := fmt.Sprintf("%s - %s", b.usage(req.channel, cmd), cmd.help)
+	if len(cmd.aliases) > 0 {
+		aliases := make([]string, 0, len(cmd.aliases))
+		for _, alias := range cmd.aliases {
+			aliases = append(aliases, prefix+nameMark+alias)
+		}
+		help += " (also " + strings.Join(aliases, ", ") + ")"
+	}
+	if cmd.perm == adminOnly {
+		help += " (admins only)"
+	}
+	return help, nil
+}
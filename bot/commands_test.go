@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommand(t *testing.T) {
+	for data, want := range map[string][]string{
+		"!calc key":             {"", "key"},
+		"!calc":                 {"", ""},
+		"!calc-history  key":    {"history", " key"},
+		"!calc-audit":           {"audit", ""},
+		"!calc-alias a = b":     {"alias", "a = b"},
+		"!calculator":           nil,
+		"!calc-":                nil,
+		"calc key":              nil,
+		"!calc-search some key": {"search", "some key"},
+	} {
+		name, args, ok := parseCommand("!calc", data)
+		if want == nil {
+			assert.False(t, ok, data)
+			continue
+		}
+		assert.True(t, ok, data)
+		assert.Equal(t, want[0], name, data)
+		assert.Equal(t, want[1], args, data)
+	}
+}
+
+func newCommandsBot(t *testing.T) *Bot {
+	b, err := NewBot(Config{
+		Channels:  []string{"#test", "#other"},
+		Prefixes:  map[string]string{"#OTHER": "?c"},
+		Nickname:  "calc",
+		Addresses: []string{"localhost:6667"},
+		Encoding:  "koi8-r",
+		Admins:    []string{"$a:boss", "*!admin@admin.example"},
+	}, nil)
+	require.NoError(t, err)
+	return b
+}
+
+func TestHandle(t *testing.T) {
+	b := newCommandsBot(t)
+	test := request{nick: "user", channel: "#test"}
+	other := request{nick: "user", channel: "#other"}
+
+	reply, err := b.handle(test, "!calc-history")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: !calc-history <key>", reply)
+
+	reply, err = b.handle(other, "?c-hist ")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: ?c-history <key>", reply)
+
+	reply, err = b.handle(other, "!calc-eval 1+1")
+	require.NoError(t, err)
+	assert.Equal(t, "", reply)
+
+	reply, err = b.handle(test, "!calc-eval 1+1")
+	require.NoError(t, err)
+	assert.Equal(t, "1+1 = 2", reply)
+
+	reply, err = b.handle(test, "!calc-unknown x")
+	require.NoError(t, err)
+	assert.Equal(t, "", reply)
+
+	_, err = b.handle(test, "!calc-audit")
+	assert.EqualError(t, err, "user is not an admin")
+}
+
+func TestCommandHelp(t *testing.T) {
+	b := newCommandsBot(t)
+	req := request{nick: "user", channel: "#other"}
+
+	help, err := b.handle(req, "?c-help")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: ?c <key>[[n]] | <key> = <content> | commands: ?c-more, ?c-alias, ?c-history, ?c-revert, "+
+		"?c-forget, ?c-undelete, ?c-search, ?c-grep, ?c-random, ?c-eval, ?c-encoding, ?c-stats, ?c-audit, ?c-limits, ?c-ignore, ?c-unignore, ?c-help | ?c-help <command> for details", help)
+
+	help, err = b.handle(req, "?c-help ?c-find")
+	require.NoError(t, err)
+	assert.Equal(t, "?c-search <pattern> - lists the keys closest to the pattern (also ?c-find)", help)
+
+	help, err = b.handle(req, "?c-help audit")
+	require.NoError(t, err)
+	assert.Equal(t, "?c-audit - shows the latest deletes and restores (admins only)", help)
+
+	help, err = b.handle(req, "?c-help nope")
+	require.NoError(t, err)
+	assert.Equal(t, `unknown command "nope"`, help)
+}
+
+func TestNewCommands(t *testing.T) {
+	_, err := newCommands(&command{name: "a"}, &command{name: "b", aliases: []string{"a"}})
+	assert.Error(t, err)
+
+	b := &Bot{conf: Config{Channels: []string{"#test"}, Prefixes: map[string]string{"#nope": "!c"}}}
+	assert.Error(t, b.initPrefixes())
+
+	b = &Bot{conf: Config{Channels: []string{"#test"}, Prefix: "! calc"}}
+	assert.Error(t, b.initPrefixes())
+}
@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"crypto/tls"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	"go.uber.org/atomic"
+
+	"github.com/adzip-kadum/irc-calc/log"
+)
+
+const (
+	defaultDialTimeout  = 30 * time.Second
+	defaultReconnectMin = time.Second
+	defaultReconnectMax = 5 * time.Minute
+
+	// RPL_WELCOME is consumed by the hellabot join trigger, registration is
+	// detected by the RPL_YOURHOST following it
+	rplYourHost = "002"
+)
+
+// Server returns the address of the server the bot is registered on or an
+// empty string if it is not connected.
+func (b *Bot) Server() string {
+	return b.server.Load()
+}
+
+// Reconnects returns how many times the bot connected again after the first
+// attempt.
+func (b *Bot) Reconnects() int64 {
+	return b.reconnects.Load()
+}
+
+func (b *Bot) currentSession() *session {
+	b.sessionMu.RLock()
+	defer b.sessionMu.RUnlock()
+	return b.session
+}
+
+func (b *Bot) setSession(s *session) {
+	b.sessionMu.Lock()
+	defer b.sessionMu.Unlock()
+	b.session = s
+}
+
+// run connects to the configured addresses in turn. After a failed connect or
+// a disconnect it waits with exponential backoff and jitter, the backoff is
+// reset once the bot registers on a server. It returns once the bot is
+// stopped.
+func (b *Bot) run() {
+	defer b.closer.WaitGroup.Done()
+
+	backoff := b.conf.ReconnectMin
+	for attempt := 0; ; attempt++ {
+		address := b.conf.Addresses[attempt%len(b.conf.Addresses)]
+		if attempt > 0 {
+			b.reconnects.Inc()
+		}
+		log.Info("connecting", log.String("address", address), log.Int("attempt", attempt))
+
+		registered, err := b.connect(address)
+		if err != nil {
+			log.Error(err, log.String("address", address), log.Int("attempt", attempt))
+		} else {
+			log.Info("disconnected", log.String("address", address))
+		}
+		if registered {
+			backoff = b.conf.ReconnectMin
+		}
+		if b.stopping() {
+			return
+		}
+
+		delay := jitter(backoff)
+		log.Info("reconnecting", log.String("address", address), log.Duration("delay", delay))
+		select {
+		case <-time.After(delay):
+		case <-b.closer.Context.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > b.conf.ReconnectMax {
+			backoff = b.conf.ReconnectMax
+		}
+	}
+}
+
+// session is a single connection to a server.
+type session struct {
+	address       string
+	registered    *atomic.Bool
+	authenticated *atomic.Bool
+	queue         *queue
+
+	mu   sync.Mutex
+	conn net.Conn
+	err  error
+}
+
+func newSession(address string) *session {
+	return &session{
+		address:       address,
+		registered:    atomic.NewBool(false),
+		authenticated: atomic.NewBool(false),
+	}
+}
+
+func (s *session) dial(timeout time.Duration) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		conn, err := net.DialTimeout(network, addr, timeout)
+		s.setConn(conn, err)
+		return conn, err
+	}
+}
+
+func (s *session) dialTLS(timeout time.Duration) func(network, addr string, conf *tls.Config) (*tls.Conn, error) {
+	return func(network, addr string, conf *tls.Config) (*tls.Conn, error) {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, addr, conf)
+		if err != nil {
+			s.setConn(nil, err)
+			return nil, err
+		}
+		s.setConn(conn, nil)
+		return conn, nil
+	}
+}
+
+func (s *session) setConn(conn net.Conn, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn = conn
+	s.err = err
+}
+
+// fail records the error and drops the connection.
+func (s *session) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+func (s *session) error() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// connect runs a session with the server until it is disconnected. It reports
+// whether the bot got registered on the server.
+func (b *Bot) connect(address string) (bool, error) {
+	s := newSession(address)
+	irc, err := b.newIRC(s)
+	if err != nil {
+		return false, err
+	}
+	// Send drops the lines once the connection is gone, the queue never
+	// gets stuck on a session which is over
+	s.queue = b.newQueue(irc.Send)
+
+	irc.AddTrigger(hbot.Trigger{
+		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
+			return m.Command == rplYourHost
+		},
+		Action: func(bot *hbot.Bot, m *hbot.Message) bool {
+			s.registered.Store(true)
+			b.server.Store(address)
+			log.Info("connected", log.String("address", address), log.Int64("reconnects", b.Reconnects()))
+			b.identify(s)
+			return false
+		},
+	})
+
+	b.members.reset()
+	b.accounts.reset()
+	b.setSession(s)
+	done := make(chan struct{})
+	go s.queue.run(done)
+	irc.Run()
+	close(done)
+	b.setSession(nil)
+	b.server.Store("")
+	if err := irc.Close(); err != nil {
+		log.Error(err)
+	}
+
+	return s.registered.Load(), s.error()
+}
+
+// jitter returns a random duration in [d/2, d).
+func jitter(d time.Duration) time.Duration {
+	if d < 2 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
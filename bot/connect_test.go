@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// welcome registers every client sending USER and drops clients sending QUIT.
+func welcome(conn net.Conn, line string) {
+	switch {
+	case strings.HasPrefix(line, "USER "):
+		fmt.Fprint(conn, ":fake 001 calc :Welcome\r\n:fake 002 calc :Your host is fake\r\n")
+	case strings.HasPrefix(line, "QUIT "):
+		conn.Close()
+	}
+}
+
+// fakeServer accepts IRC connections and passes every line received to the
+// handler. Accepted connections are sent to the channel.
+func fakeServer(t *testing.T, handler func(conn net.Conn, line string)) (string, chan net.Conn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	conns := make(chan net.Conn, 16)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+			go func() {
+				scan := bufio.NewScanner(conn)
+				for scan.Scan() {
+					handler(conn, scan.Text())
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), conns
+}
+
+// deadAddress returns an address nobody listens on.
+func deadAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	require.NoError(t, l.Close())
+	return address
+}
+
+func TestFailover(t *testing.T) {
+	dead := deadAddress(t)
+	alive, conns := fakeServer(t, welcome)
+
+	b, err := NewBot(Config{
+		Channels:     []string{"#test"},
+		Nickname:     fmt.Sprintf("calc%d", rand.Int63()),
+		Addresses:    []string{dead, alive},
+		Encoding:     "koi8-r",
+		ReconnectMin: 10 * time.Millisecond,
+		ReconnectMax: 50 * time.Millisecond,
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	t.Cleanup(func() { b.Stop() })
+
+	require.Eventually(t, func() bool { return b.Server() == alive }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), b.Reconnects())
+
+	// the server drops the connection, the bot goes through the dead address
+	// again and comes back
+	(<-conns).Close()
+	require.Eventually(t, func() bool { return b.Reconnects() == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return b.Server() == alive }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStop(t *testing.T) {
+	quits := make(chan string, 1)
+	address, _ := fakeServer(t, func(conn net.Conn, line string) {
+		if strings.HasPrefix(line, "QUIT ") {
+			quits <- line
+		}
+		welcome(conn, line)
+	})
+
+	b, err := NewBot(Config{
+		Channels:     []string{"#test"},
+		Nickname:     fmt.Sprintf("calc%d", rand.Int63()),
+		Addresses:    []string{address},
+		Encoding:     "koi8-r",
+		ReconnectMin: 10 * time.Millisecond,
+		QuitMessage:  "see you",
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	require.Eventually(t, func() bool { return b.Server() == address }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, b.Stop())
+	assert.Equal(t, "QUIT :see you", <-quits)
+	assert.Equal(t, "", b.Server())
+	assert.Equal(t, int64(0), b.Reconnects())
+}
+
+func TestStopTimeout(t *testing.T) {
+	// the server ignores QUIT
+	address, _ := fakeServer(t, func(conn net.Conn, line string) {
+		if !strings.HasPrefix(line, "QUIT ") {
+			welcome(conn, line)
+		}
+	})
+
+	b, err := NewBot(Config{
+		Channels:    []string{"#test"},
+		Nickname:    fmt.Sprintf("calc%d", rand.Int63()),
+		Addresses:   []string{address},
+		Encoding:    "koi8-r",
+		StopTimeout: 100 * time.Millisecond,
+	}, nil)
+	require.NoError(t, err)
+	require.NoError(t, b.Start())
+	require.Eventually(t, func() bool { return b.Server() == address }, 5*time.Second, 10*time.Millisecond)
+
+	assert.Error(t, b.Stop())
+	assert.Equal(t, "", b.Server())
+}
+
+func TestSendAfterDisconnect(t *testing.T) {
+	address, conns := fakeServer(t, welcome)
+	b, err := NewBot(Config{
+		Channels:  []string{"#test"},
+		Nickname:  fmt.Sprintf("calc%d", rand.Int63()),
+		Addresses: []string{address},
+		Encoding:  "koi8-r",
+	}, nil)
+	require.NoError(t, err)
+	s := newSession(address)
+	irc, err := b.newIRC(s)
+	require.NoError(t, err)
+	s.queue = b.newQueue(irc.Send)
+
+	ran := make(chan struct{})
+	go func() {
+		irc.Run()
+		close(ran)
+	}()
+	(<-conns).Close()
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the session is not over")
+	}
+	t.Cleanup(func() { irc.Close() })
+
+	// the queue of a session which is over is never stuck sending
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			irc.Send("PRIVMSG #test :hi")
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send blocks after the disconnect")
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second)
+		assert.True(t, d >= 500*time.Millisecond && d < time.Second, d)
+	}
+}
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/adzip-kadum/irc-calc/expr"
+)
+
+const evalTimeout = 100 * time.Millisecond
+
+var plainNumber = regexp.MustCompile(`^[\d.]+$`)
+
+// evalExpression is the calculator mode: "!calc-eval 2+2*3".
+func (b *Bot) evalExpression(req request, data string) (string, error) {
+	input := strings.TrimSpace(spaces.ReplaceAllString(data, " "))
+	result, err := eval(input)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s = %s", input, result), nil
+}
+
+// evalMissing evaluates a missing key if it is an expression.
+func evalMissing(key string) (string, bool) {
+	if plainNumber.MatchString(key) {
+		return "", false
+	}
+	result, err := eval(key)
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s = %s", key, result), true
+}
+
+func eval(input string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), evalTimeout)
+	defer cancel()
+	return expr.Eval(ctx, input)
+}
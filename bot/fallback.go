@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/unicode/norm"
+)
+
+// what is sent instead of the characters the charset can not encode
+const (
+	fallbackReplace       = "replace"
+	fallbackTransliterate = "transliterate"
+	fallbackStrip         = "strip"
+
+	defaultFallback = fallbackTransliterate
+	replacement     = "?"
+)
+
+// equivalents of the characters missing in some charsets, the first one the
+// charset encodes is used
+var transliterations = map[rune][]string{
+	'і': {"i"}, 'І': {"I"},
+	'ї': {"ї", "i"}, 'Ї': {"Ї", "I"},
+	'є': {"е"}, 'Є': {"Е"},
+	'ґ': {"г"}, 'Ґ': {"Г"},
+	'ў': {"у"}, 'Ў': {"У"},
+	'ё': {"е"}, 'Ё': {"Е"},
+	'«': {`"`}, '»': {`"`}, '“': {`"`}, '”': {`"`}, '„': {`"`},
+	'‘': {"'"}, '’': {"'"},
+	'—': {"-"}, '–': {"-"}, '−': {"-"},
+	'…': {"..."},
+	'№': {"N"},
+	'€': {"EUR"},
+	' ': {" "},
+}
+
+// checkFallback validates the policy, an empty one is the default.
+func checkFallback(policy string) (string, error) {
+	switch policy {
+	case "":
+		return defaultFallback, nil
+	case fallbackReplace, fallbackTransliterate, fallbackStrip:
+		return policy, nil
+	}
+	return "", errors.Errorf("unknown unencodable policy %q, known: %s, %s, %s",
+		policy, fallbackReplace, fallbackTransliterate, fallbackStrip)
+}
+
+// fallbackEncoder encodes the text, the characters the encoder can not
+// encode are replaced according to the policy.
+type fallbackEncoder struct {
+	encoder *encoding.Encoder
+	policy  string
+}
+
+func (fe fallbackEncoder) String(text string) (string, error) {
+	encoded, err := fe.encoder.String(text)
+	if err == nil {
+		return encoded, nil
+	}
+
+	var sb strings.Builder
+	for _, r := range text {
+		encoded, err := fe.encoder.String(string(r))
+		if err != nil {
+			encoded, err = fe.encoder.String(fe.substitute(r))
+		}
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		sb.WriteString(encoded)
+	}
+	return sb.String(), nil
+}
+
+// substitute returns what to encode instead of the character.
+func (fe fallbackEncoder) substitute(r rune) string {
+	switch fe.policy {
+	case fallbackStrip:
+		return ""
+	case fallbackTransliterate:
+		for _, s := range transliterations[r] {
+			if _, err := fe.encoder.String(s); err == nil {
+				return s
+			}
+		}
+		// latin letters with diacritics lose them
+		var base []rune
+		for _, d := range norm.NFD.String(string(r)) {
+			if !unicode.Is(unicode.Mn, d) {
+				base = append(base, d)
+			}
+		}
+		if len(base) > 0 && string(base) != string(r) {
+			if _, err := fe.encoder.String(string(base)); err == nil {
+				return string(base)
+			}
+		}
+	}
+	return replacement
+}
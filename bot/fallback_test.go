@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestFallbackEncoder(t *testing.T) {
+	for policy, want := range map[string]string{
+		fallbackReplace:       "?? веч?р ? ? caf?",
+		fallbackTransliterate: "I? вечiр - ... cafe",
+		fallbackStrip:         " вечр   caf",
+	} {
+		fe := fallbackEncoder{encoder: charmap.KOI8R.NewEncoder(), policy: policy}
+		encoded, err := fe.String("Ї🙂 вечір — … café")
+		require.NoError(t, err, policy)
+		text, err := charmap.KOI8R.NewDecoder().String(encoded)
+		require.NoError(t, err)
+		assert.Equal(t, want, text, policy)
+	}
+
+	// encodable text is left as is
+	fe := fallbackEncoder{encoder: charmap.Windows1251.NewEncoder(), policy: fallbackTransliterate}
+	encoded, err := fe.String("№ 1 — ok")
+	require.NoError(t, err)
+	assert.Equal(t, "\xb9 1 \x97 ok", encoded)
+}
+
+func TestCheckFallback(t *testing.T) {
+	policy, err := checkFallback("")
+	require.NoError(t, err)
+	assert.Equal(t, fallbackTransliterate, policy)
+
+	_, err = checkFallback("ignore")
+	assert.Error(t, err)
+}
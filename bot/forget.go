@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	auditLimit = 10
+)
+
+// forgetCalc soft-deletes the version with the given index or, without an
+// index, every version of the key.
+func (b *Bot) forgetCalc(req request, data string) (string, error) {
+	key, index := splitIndex(data)
+	calcs, err := b.repo.GetCalcs(context.Background(), repository.GetCalcsParams{
+		Channel: req.channel,
+		NormKey: b.normKey(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(calcs) == 0 {
+		return fmt.Sprintf("there is no calcs with %q", key), nil
+	}
+	calcs, err = selectByIndex(index, calcs)
+	if err != nil {
+		return "", err
+	}
+	deleted, err := b.repo.DeleteCalcs(context.Background(), calcs, req.nick, req.when.UTC())
+	if err != nil {
+		return "", err
+	}
+	if deleted > 0 {
+		b.recordLookup(req, key, true, true)
+	}
+	return fmt.Sprintf("%s: %d version(s) forgotten by %s", key, deleted, req.nick), nil
+}
+
+// undeleteCalc restores the deleted version with the given index or, without
+// an index, every deleted version of the key. Indexes count deleted versions
+// only.
+func (b *Bot) undeleteCalc(req request, data string) (string, error) {
+	key, index := splitIndex(data)
+	calcs, err := b.repo.GetDeletedCalcs(context.Background(), repository.GetDeletedCalcsParams{
+		Channel: req.channel,
+		NormKey: b.normKey(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(calcs) == 0 {
+		return fmt.Sprintf("there is no deleted calcs with %q", key), nil
+	}
+	calcs, err = selectByIndex(index, calcs)
+	if err != nil {
+		return "", err
+	}
+	restored, err := b.repo.UndeleteCalcs(context.Background(), calcs, req.nick, req.when.UTC())
+	if err != nil {
+		return "", err
+	}
+	if restored > 0 {
+		b.recordLookup(req, key, true, true)
+	}
+	return fmt.Sprintf("%s: %d version(s) restored by %s", key, restored, req.nick), nil
+}
+
+// calcAudit shows the latest delete and undelete actions in the channel.
+func (b *Bot) calcAudit(req request, _ string) (string, error) {
+	audit, err := b.repo.GetAudit(context.Background(), repository.GetAuditParams{
+		Channel: req.channel,
+		Limit:   auditLimit,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(audit) == 0 {
+		return "audit is empty", nil
+	}
+	actions := make([]string, 0, len(audit))
+	for _, a := range audit {
+		actions = append(actions, fmt.Sprintf("%s %s %q #%d %s",
+			a.By, a.Action, a.Key, a.CalcID, a.When.UTC().Format("2006-01-02 15:04")))
+	}
+	return strings.Join(actions, " | "), nil
+}
+
+// isAdmin reports whether the sender of the request matches one of the admin
+// masks.
+func (b *Bot) isAdmin(req request) bool {
+	for _, admin := range b.conf.Admins {
+		if matchMask(admin, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectByIndex returns the calc with the given index or all of them if the
+// index is empty.
+func selectByIndex(index string, calcs []repository.IrcCalc) ([]repository.IrcCalc, error) {
+	if index == "" {
+		return calcs, nil
+	}
+	calcs, _, err := pickCalcs(index, calcs)
+	return calcs, err
+}
@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestSelectByIndex(t *testing.T) {
+	calcs := []repository.IrcCalc{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	// without an index the whole key is forgotten
+	selected, err := selectByIndex("", calcs)
+	require.NoError(t, err)
+	assert.Equal(t, calcs, selected)
+
+	selected, err = selectByIndex("1", calcs)
+	require.NoError(t, err)
+	assert.Equal(t, []repository.IrcCalc{{ID: 2}}, selected)
+
+	selected, err = selectByIndex("-1", calcs)
+	require.NoError(t, err)
+	assert.Equal(t, []repository.IrcCalc{{ID: 3}}, selected)
+
+	selected, err = selectByIndex("0..1", calcs)
+	require.NoError(t, err)
+	assert.Equal(t, []repository.IrcCalc{{ID: 1}, {ID: 2}}, selected)
+
+	_, err = selectByIndex("3", calcs)
+	assert.EqualError(t, err, "calc index 3 out of range, max 2")
+}
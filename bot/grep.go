@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	grepLimit = 20
+	// more results than that are sent privately
+	grepInline  = 3
+	grepContent = 80
+)
+
+// grepCalcs finds calcs by their content using the full-text search, ranked
+// by relevance.
+func (b *Bot) grepCalcs(req request, data string) (string, error) {
+	words := strings.TrimSpace(spaces.ReplaceAllString(data, " "))
+	if words == "" {
+		return "", nil
+	}
+	rows, err := b.repo.SearchCalcContent(context.Background(), repository.SearchCalcContentParams{
+		Words:   words,
+		Channel: req.channel,
+		Lim:     grepLimit,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return fmt.Sprintf("nothing found for %q", words), nil
+	}
+	found := make([]string, 0, len(rows))
+	for _, row := range rows {
+		found = append(found, fmt.Sprintf("%s = %s [%s, %s]",
+			row.Key, truncate(calcText(row.Content), grepContent), row.By, row.When.UTC().Format("2006-01-02")))
+	}
+	return b.grepReply(req, words, found)
+}
+
+// grepReply returns a few calcs found inline, more of them are sent to the
+// nick privately not to flood the channel.
+func (b *Bot) grepReply(req request, words string, found []string) (string, error) {
+	if len(found) <= grepInline {
+		return strings.Join(found, " | "), nil
+	}
+	for _, line := range found {
+		if err := b.msg(req.nick, req.charset, line); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d calcs found for %q, sent to %s privately", len(found), words, req.nick), nil
+}
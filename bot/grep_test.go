@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGrepReply(t *testing.T) {
+	b := newCommandsBot(t)
+	s := &session{queue: b.newQueue(nil)}
+	b.setSession(s)
+	req := request{nick: "user", channel: "#test"}
+
+	found := []string{"a = 1", "b = 2", "c = 3"}
+	reply, err := b.grepReply(req, "x", found)
+	require.NoError(t, err)
+	assert.Equal(t, "a = 1 | b = 2 | c = 3", reply)
+	_, ok := s.queue.pop()
+	assert.False(t, ok)
+
+	found = append(found, "d = 4")
+	reply, err = b.grepReply(req, "x", found)
+	require.NoError(t, err)
+	assert.Equal(t, `4 calcs found for "x", sent to user privately`, reply)
+	var sent []string
+	for {
+		line, ok := s.queue.pop()
+		if !ok {
+			break
+		}
+		sent = append(sent, line)
+	}
+	assert.Equal(t, "PRIVMSG user :a = 1|PRIVMSG user :b = 2|PRIVMSG user :c = 3|PRIVMSG user :d = 4",
+		strings.Join(sent, "|"))
+}
@@ -0,0 +1,124 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	historyLimit   = 10
+	historyContent = 40
+)
+
+// calcHistory lists the latest versions of the key with their indexes, so
+// they can be requested with the [n] syntax or reverted.
+func (b *Bot) calcHistory(req request, data string) (string, error) {
+	key, _ := splitIndex(data)
+	calcs, err := b.repo.GetCalcs(context.Background(), repository.GetCalcsParams{
+		Channel: req.channel,
+		NormKey: b.normKey(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(calcs) == 0 {
+		return fmt.Sprintf("there is no calcs with %q", key), nil
+	}
+	return formatHistory(key, calcs), nil
+}
+
+// formatHistory lists the latest historyLimit versions, the content as it is
+// shown.
+func formatHistory(key string, calcs []repository.IrcCalc) string {
+	first := 0
+	if len(calcs) > historyLimit {
+		first = len(calcs) - historyLimit
+	}
+	versions := make([]string, 0, len(calcs)-first)
+	for i := first; i < len(calcs); i++ {
+		c := calcs[i]
+		versions = append(versions, fmt.Sprintf("[%d] %s %s: %s",
+			i, c.By, c.When.UTC().Format("2006-01-02"), truncate(calcText(c.Content), historyContent)))
+	}
+	history := strings.Join(versions, " | ")
+	if first > 0 {
+		history = fmt.Sprintf("%d older ... | %s", first, history)
+	}
+	return fmt.Sprintf("%s (%d versions): %s", key, len(calcs), history)
+}
+
+// revertCalc adds the version with the given index as the newest one. Without
+// an index the version preceding the latest one is restored.
+func (b *Bot) revertCalc(req request, data string) (string, error) {
+	key, index := splitIndex(data)
+	calcs, err := b.repo.GetCalcs(context.Background(), repository.GetCalcsParams{
+		Channel: req.channel,
+		NormKey: b.normKey(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(calcs) == 0 {
+		return fmt.Sprintf("there is no calcs with %q", key), nil
+	}
+	num, err := revertVersion(index, len(calcs))
+	if err != nil {
+		return "", err
+	}
+	if num < 0 {
+		return fmt.Sprintf("%q has no older versions", key), nil
+	}
+	// the key is kept as it was written
+	key = calcs[len(calcs)-1].Key
+	content := calcs[num].Content
+	if target, ok := aliasTarget(content); ok {
+		if err := b.checkAlias(req.channel, key, target); err != nil {
+			return "", err
+		}
+	}
+	params := repository.AddCalcParams{
+		Channel: req.channel,
+		Key:     key,
+		NormKey: b.normKey(key),
+		By:      req.nick,
+		When:    req.when.UTC(),
+		Content: content,
+	}
+	if _, err := b.repo.AddCalc(context.Background(), params); err != nil {
+		return "", err
+	}
+	b.recordLookup(req, key, true, true)
+	return fmt.Sprintf("%s = %s [%s, %s, reverted to %d]",
+		key, calcText(content), req.nick, formatTime(req.when), num), nil
+}
+
+// revertVersion returns the index of the version to revert to, the one
+// preceding the latest version without an index. It is negative if there is
+// no such version.
+func revertVersion(index string, total int) (int, error) {
+	if index == "" {
+		return total - 2, nil
+	}
+	first, last, err := versionRange(index, total)
+	if err != nil {
+		return 0, err
+	}
+	if first != last {
+		return 0, errors.Errorf("a single version can be reverted to, not %s", index)
+	}
+	return first, nil
+}
+
+// truncate shortens s to at most n runes, marking the cut with dots.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
@@ -0,0 +1,55 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestFormatHistory(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	calcs := []repository.IrcCalc{
+		{By: "a", When: when, Content: "first"},
+		{By: "b", When: when, Content: "@@here at 5"},
+		{By: "c", When: when, Content: strings.Repeat("x", historyContent+1)},
+	}
+	assert.Equal(t, "key (3 versions): [0] a 2024-01-02: first | [1] b 2024-01-02: @here at 5 | "+
+		"[2] c 2024-01-02: "+strings.Repeat("x", historyContent-3)+"...",
+		formatHistory("key", calcs))
+
+	calcs = nil
+	for i := 0; i < historyLimit+2; i++ {
+		calcs = append(calcs, repository.IrcCalc{By: "a", When: when, Content: fmt.Sprint(i)})
+	}
+	history := formatHistory("key", calcs)
+	assert.True(t, strings.HasPrefix(history, "key (12 versions): 2 older ... | [2] a 2024-01-02: 2 | "), history)
+	assert.True(t, strings.HasSuffix(history, "| [11] a 2024-01-02: 11"), history)
+}
+
+func TestRevertVersion(t *testing.T) {
+	// the version preceding the latest one by default
+	num, err := revertVersion("", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 1, num)
+	num, err = revertVersion("", 1)
+	require.NoError(t, err)
+	assert.Negative(t, num)
+
+	num, err = revertVersion("0", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, num)
+	num, err = revertVersion("-1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, num)
+
+	_, err = revertVersion("0..1", 3)
+	assert.EqualError(t, err, "a single version can be reverted to, not 0..1")
+	_, err = revertVersion("3", 3)
+	assert.EqualError(t, err, "calc index 3 out of range, max 2")
+}
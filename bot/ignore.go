@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	hbot "github.com/whyrusleeping/hellabot"
+
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	// the masks of accounts, as in the bans of the servers: "$a:account"
+	accountMark = "$a:"
+	readOnlyArg = "readonly"
+
+	// the list is shared by the bots through the database, the changes
+	// made through the other bots are seen after a reload
+	ignoresReloadInterval = time.Minute
+)
+
+// ignoreList is the persistent list of the nicks the bot does not answer or
+// does not let change calcs. It is reloaded periodically and on changes, the
+// messages are never held up by the database.
+type ignoreList struct {
+	mu      sync.RWMutex
+	entries []repository.IrcIgnore
+}
+
+func newIgnoreList() *ignoreList {
+	return &ignoreList{}
+}
+
+func (il *ignoreList) set(entries []repository.IrcIgnore) {
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	il.entries = entries
+}
+
+// list returns the entries formatted for a reply.
+func (il *ignoreList) list() []string {
+	il.mu.RLock()
+	defer il.mu.RUnlock()
+	masks := make([]string, 0, len(il.entries))
+	for _, entry := range il.entries {
+		masks = append(masks, formatIgnore(entry))
+	}
+	return masks
+}
+
+// match returns the first entry matching the sender.
+func (il *ignoreList) match(req request) *repository.IrcIgnore {
+	il.mu.RLock()
+	defer il.mu.RUnlock()
+	for _, entry := range il.entries {
+		if matchMask(entry.Mask, req) {
+			entry := entry
+			return &entry
+		}
+	}
+	return nil
+}
+
+// matchMask reports whether the mask matches the sender of the request.
+// Masks and accounts may contain * and ? wildcards, case is ignored.
+func matchMask(mask string, req request) bool {
+	if account := strings.TrimPrefix(mask, accountMark); account != mask {
+		return req.account != "" && wildcardMatch(strings.ToLower(account), strings.ToLower(req.account))
+	}
+	return wildcardMatch(strings.ToLower(mask), strings.ToLower(req.nick+"!"+req.user+"@"+req.host))
+}
+
+// wildcardMatch matches the text against the pattern, * matches any
+// characters and ? a single one. Unlike path.Match, brackets and backslashes,
+// common in nicks, are not special.
+func wildcardMatch(pattern, text string) bool {
+	p, t := []rune(pattern), []rune(text)
+	// the position after the last * and the text it was matched up to
+	star, starT := -1, 0
+	i, j := 0, 0
+	for j < len(t) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, starT = i+1, j
+			i++
+		case i < len(p) && (p[i] == '?' || p[i] == t[j]):
+			i++
+			j++
+		case star >= 0:
+			starT++
+			i, j = star, starT
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// normalizeMask completes the mask the way the servers complete bans:
+// "nick" is "nick!*@*", "user@host" is "*!user@host".
+func normalizeMask(mask string) (string, error) {
+	if strings.HasPrefix(mask, accountMark) {
+		if len(mask) == len(accountMark) {
+			return "", errors.Errorf("empty account in %q", mask)
+		}
+		return mask, nil
+	}
+	if mask == "" || strings.HasPrefix(mask, "$") {
+		return "", errors.Errorf("invalid mask %q, use nick!user@host or %saccount", mask, accountMark)
+	}
+	nick, rest := mask, "*@*"
+	if i := strings.Index(mask, "!"); i >= 0 {
+		nick, rest = mask[:i], mask[i+1:]
+		if !strings.Contains(rest, "@") {
+			rest += "@*"
+		}
+	} else if strings.Contains(mask, "@") {
+		nick, rest = "*", mask
+	}
+	if nick == "" {
+		nick = "*"
+	}
+	return nick + "!" + rest, nil
+}
+
+// initAdmins checks the admin masks. Nicks alone are not accepted, anyone can
+// take the nick of an admin who is offline.
+func (b *Bot) initAdmins() error {
+	for _, admin := range b.conf.Admins {
+		if strings.HasPrefix(admin, accountMark) && len(admin) > len(accountMark) {
+			continue
+		}
+		i := strings.Index(admin, "!")
+		if i < 0 || !strings.Contains(admin[i:], "@") || strings.Trim(admin[i+1:], "*?@") == "" {
+			return errors.Errorf("admin %q is not a nick!user@host mask with a user or a host, or %saccount",
+				admin, accountMark)
+		}
+	}
+	return nil
+}
+
+// ignoreOf returns the entry of the ignore list matching the sender of the
+// request. Admins are never ignored.
+func (b *Bot) ignoreOf(req request) *repository.IrcIgnore {
+	if b.isAdmin(req) {
+		return nil
+	}
+	return b.ignores.match(req)
+}
+
+// ignoredSender reports whether the sender of the message is ignored
+// completely, checked before the message is handled.
+func (b *Bot) ignoredSender(m *hbot.Message) bool {
+	nick, err := b.charset.decode(m.From)
+	if err != nil {
+		return false
+	}
+	req := request{nick: nick, account: b.accounts.get(m.From)}
+	if m.Prefix != nil {
+		req.user, req.host = m.Prefix.User, m.Prefix.Host
+	}
+	entry := b.ignoreOf(req)
+	return entry != nil && !entry.ReadOnly
+}
+
+// refreshIgnores reloads the ignore list, the list loaded before is kept if
+// the database is not available.
+func (b *Bot) refreshIgnores() {
+	if err := b.reloadIgnores(); err != nil {
+		log.Error(err, log.String("nick", b.conf.Nickname))
+	}
+}
+
+// reloadIgnores reads the ignore list again.
+func (b *Bot) reloadIgnores() error {
+	entries, err := b.repo.GetIgnores(context.Background())
+	if err != nil {
+		return err
+	}
+	b.ignores.set(entries)
+	return nil
+}
+
+// ignoreCommand lists the ignore list or adds the mask to it:
+// "!calc-ignore *!*@spam.example readonly".
+func (b *Bot) ignoreCommand(req request, data string) (string, error) {
+	args := strings.Fields(data)
+	if len(args) == 0 {
+		if err := b.reloadIgnores(); err != nil {
+			return "", err
+		}
+		masks := b.ignores.list()
+		if len(masks) == 0 {
+			return "the ignore list is empty", nil
+		}
+		return "ignore list: " + strings.Join(masks, ", "), nil
+	}
+	if len(args) > 2 || (len(args) == 2 && args[1] != readOnlyArg) {
+		return "usage: " + b.usage(req.channel, b.commands.lookup("ignore")), nil
+	}
+	mask, err := normalizeMask(args[0])
+	if err != nil {
+		return "", err
+	}
+	entry := repository.SetIgnoreParams{
+		Mask:     mask,
+		ReadOnly: len(args) == 2,
+		By:       req.nick,
+		When:     req.when.UTC(),
+	}
+	if err := b.repo.SetIgnore(context.Background(), entry); err != nil {
+		return "", err
+	}
+	if err := b.reloadIgnores(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s ignored by %s", formatIgnore(repository.IrcIgnore(entry)), req.nick), nil
+}
+
+// unignoreCommand removes the mask from the ignore list.
+func (b *Bot) unignoreCommand(req request, data string) (string, error) {
+	mask, err := normalizeMask(strings.TrimSpace(data))
+	if err != nil {
+		return "", err
+	}
+	deleted, err := b.repo.DeleteIgnore(context.Background(), mask)
+	if err != nil {
+		return "", err
+	}
+	if deleted == 0 {
+		return fmt.Sprintf("%s is not ignored", mask), nil
+	}
+	if err := b.reloadIgnores(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is no longer ignored", mask), nil
+}
+
+func formatIgnore(entry repository.IrcIgnore) string {
+	if entry.ReadOnly {
+		return entry.Mask + " (read-only)"
+	}
+	return entry.Mask
+}
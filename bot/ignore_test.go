@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	hbot "github.com/whyrusleeping/hellabot"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"*", "", true},
+		{"*", "*a", true},
+		{"nick!*@*", "nick!user@host", true},
+		{"nick!*@*", "nick2!user@host", false},
+		{"*!*@*.example", "x!y@a.b.example", true},
+		{"*!*@*.example", "x!y@example", false},
+		{"[away]!*@*", "[away]!u@h", true},
+		{"n?ck!*@*", "nick!u@h", true},
+		{"n?ck!*@*", "nck!u@h", false},
+		{"*a*b", "xaxxb", true},
+		{"*a*b", "xaxxbc", false},
+	} {
+		assert.Equal(t, c.want, wildcardMatch(c.pattern, c.text), "%s %s", c.pattern, c.text)
+	}
+}
+
+func TestNormalizeMask(t *testing.T) {
+	for mask, want := range map[string]string{
+		"nick":        "nick!*@*",
+		"nick!user":   "nick!user@*",
+		"user@host":   "*!user@host",
+		"!user@host":  "*!user@host",
+		"n!u@h":       "n!u@h",
+		"$a:spammer":  "$a:spammer",
+		"$a:spam*":    "$a:spam*",
+		"*!*@*.local": "*!*@*.local",
+	} {
+		got, err := normalizeMask(mask)
+		require.NoError(t, err, mask)
+		assert.Equal(t, want, got, mask)
+	}
+	for _, mask := range []string{"", "$a:", "$x:y"} {
+		_, err := normalizeMask(mask)
+		assert.Error(t, err, mask)
+	}
+}
+
+func TestIgnoreOf(t *testing.T) {
+	b := newCommandsBot(t)
+	b.ignores.set([]repository.IrcIgnore{
+		{Mask: "*!*@spam.example"},
+		{Mask: "$a:Troll"},
+		{Mask: "reader!*@*", ReadOnly: true},
+		{Mask: "boss!*@*"},
+	})
+
+	assert.NotNil(t, b.ignoreOf(request{nick: "x", user: "y", host: "SPAM.example"}))
+	assert.Nil(t, b.ignoreOf(request{nick: "x", user: "y", host: "ham.example"}))
+	assert.NotNil(t, b.ignoreOf(request{nick: "x", account: "troll"}))
+	assert.Nil(t, b.ignoreOf(request{nick: "troll"}))
+	// admins are never ignored, the nick of an admin is not enough
+	assert.Nil(t, b.ignoreOf(request{nick: "boss", account: "boss"}))
+	assert.NotNil(t, b.ignoreOf(request{nick: "boss"}))
+
+	entry := b.ignoreOf(request{nick: "Reader", user: "u", host: "h"})
+	require.NotNil(t, entry)
+	assert.True(t, entry.ReadOnly)
+
+	assert.True(t, b.ignoredSender(hbot.ParseMessage(":x!y@spam.example PRIVMSG #test :!calc key")))
+	assert.False(t, b.ignoredSender(hbot.ParseMessage(":reader!u@h PRIVMSG #test :!calc key")))
+	assert.False(t, b.ignoredSender(hbot.ParseMessage(":x!y@ham.example PRIVMSG #test :!calc key")))
+
+	b.accounts.update(hbot.ParseMessage(":x!y@ham.example ACCOUNT troll"))
+	assert.True(t, b.ignoredSender(hbot.ParseMessage(":x!y@ham.example PRIVMSG #test :!calc key")))
+}
+
+func TestReadOnlyIgnore(t *testing.T) {
+	b := newCommandsBot(t)
+	b.ignores.set([]repository.IrcIgnore{{Mask: "reader!*@*", ReadOnly: true}})
+	req := request{nick: "reader", user: "u", host: "h", channel: "#test"}
+
+	reply, err := b.handle(req, "!calc-eval 1+1")
+	require.NoError(t, err)
+	assert.Equal(t, "1+1 = 2", reply)
+
+	_, err = b.handle(req, "!calc key = value")
+	assert.EqualError(t, err, "reader may not change calcs")
+
+	_, err = b.handle(req, "!calc-forget key")
+	assert.EqualError(t, err, "reader may not change calcs")
+}
+
+func TestIgnoreCommandUsage(t *testing.T) {
+	b := newCommandsBot(t)
+	req := request{nick: "boss", account: "boss", channel: "#test"}
+
+	reply, err := b.handle(req, "!calc-ignore nick forever")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: !calc-ignore [<nick!user@host|$a:account> [readonly]]", reply)
+
+	_, err = b.handle(request{nick: "user", channel: "#test"}, "!calc-ignore nick")
+	assert.EqualError(t, err, "user is not an admin")
+
+	_, err = b.handle(request{nick: "boss", user: "u", host: "h", channel: "#test"}, "!calc-unignore boss")
+	assert.EqualError(t, err, "boss is not an admin")
+
+	_, err = b.handle(req, "!calc-unignore $x")
+	assert.Error(t, err)
+}
+
+func TestAdmins(t *testing.T) {
+	b := newCommandsBot(t)
+	assert.True(t, b.isAdmin(request{nick: "boss", account: "Boss"}))
+	assert.True(t, b.isAdmin(request{nick: "anyone", user: "admin", host: "admin.example"}))
+	assert.False(t, b.isAdmin(request{nick: "boss", user: "u", host: "h"}))
+
+	for _, admins := range [][]string{{"boss"}, {"boss!*@*"}, {"$a:"}, {"boss@host"}} {
+		b.conf.Admins = admins
+		assert.Error(t, b.initAdmins(), "%v", admins)
+	}
+	b.conf.Admins = []string{"boss!*@host.example", "*!~boss@*", "$a:boss"}
+	assert.NoError(t, b.initAdmins())
+}
+
+func TestRefreshIgnoresKeepsList(t *testing.T) {
+	b := newCommandsBot(t)
+	b.ignores.set([]repository.IrcIgnore{{Mask: "*!*@spam.example"}})
+	// there is no database, the loaded list stays
+	b.refreshIgnores()
+	assert.Equal(t, []string{"*!*@spam.example"}, b.ignores.list())
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+// the version shown when no index is given
+const (
+	versionOldest = "oldest"
+	versionNewest = "newest"
+	// calcs can not be rated yet
+	versionRated = "highest-rated"
+
+	lastIndex = "last"
+	rangeMark = ".."
+
+	// at most this many reply lines worth of versions are shown at once
+	shownVersionsFactor = 2
+)
+
+// initVersions checks the default versions of the channels.
+func (b *Bot) initVersions() error {
+	if b.conf.DefaultVersion == "" {
+		b.conf.DefaultVersion = versionOldest
+	}
+	versions := map[string]string{"": b.conf.DefaultVersion}
+	for channel, version := range b.conf.DefaultVersions {
+		if b.channel(channel) == "" {
+			return errors.Errorf("default version %q for unknown channel %q", version, channel)
+		}
+		versions[channel] = version
+	}
+	for channel, version := range versions {
+		switch version {
+		case versionOldest, versionNewest:
+		case versionRated:
+			return errors.Errorf("default version %q for channel %q is not supported, calcs have no ratings", version, channel)
+		default:
+			return errors.Errorf("invalid default version %q for channel %q, use %s or %s",
+				version, channel, versionOldest, versionNewest)
+		}
+	}
+	return nil
+}
+
+// defaultIndex returns the index of the version shown in the channel when no
+// index is given.
+func (b *Bot) defaultIndex(channel string) string {
+	version := b.conf.DefaultVersion
+	for name, v := range b.conf.DefaultVersions {
+		if strings.EqualFold(name, channel) {
+			version = v
+		}
+	}
+	if version == versionNewest {
+		return "-1"
+	}
+	return "0"
+}
+
+// versionRange returns the first and the last of n versions selected by the
+// index: "n", "-n" counting from the newest one, "last" or a range "a..b".
+func versionRange(index string, n int) (int, int, error) {
+	if index == lastIndex {
+		index = "-1"
+	}
+	bounds := strings.SplitN(index, rangeMark, 2)
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	last := first
+	if len(bounds) > 1 {
+		if last, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+	}
+	if first < 0 {
+		first += n
+	}
+	if last < 0 {
+		last += n
+	}
+	if first < 0 || first > n-1 || last < 0 || last > n-1 {
+		return 0, 0, errors.Errorf("calc index %s out of range, max %d", index, n-1)
+	}
+	if first > last {
+		return 0, 0, errors.Errorf("empty calc range %s", index)
+	}
+	return first, last, nil
+}
+
+// checkShown makes sure the range is not too long to show, each version
+// shown costs queries and reply lines.
+func (b *Bot) checkShown(index string, first, last int) error {
+	if max := b.conf.MaxReplyLines * shownVersionsFactor; last-first+1 > max {
+		return errors.Errorf("calc range %s has %d versions, at most %d are shown", index, last-first+1, max)
+	}
+	return nil
+}
+
+// pickCalcs returns the versions selected by the index and the index of the
+// first one.
+func pickCalcs(index string, calcs []repository.IrcCalc) ([]repository.IrcCalc, int, error) {
+	first, last, err := versionRange(index, len(calcs))
+	if err != nil {
+		return nil, 0, err
+	}
+	return calcs[first : last+1], first, nil
+}
+
+// position tells which of the versions is shown.
+func position(i, total int) string {
+	return fmt.Sprintf(" (%d/%d)", i+1, total)
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestVersionRange(t *testing.T) {
+	for index, want := range map[string][2]int{
+		"0":     {0, 0},
+		"4":     {4, 4},
+		"-1":    {4, 4},
+		"last":  {4, 4},
+		"-5":    {0, 0},
+		"1..3":  {1, 3},
+		"2..-1": {2, 4},
+		"3..3":  {3, 3},
+	} {
+		first, last, err := versionRange(index, 5)
+		require.NoError(t, err, index)
+		assert.Equal(t, want, [2]int{first, last}, index)
+	}
+
+	for _, index := range []string{"5", "-6", "3..1", "0..5", "x"} {
+		_, _, err := versionRange(index, 5)
+		assert.Error(t, err, index)
+	}
+
+	_, _, err := versionRange("7", 5)
+	assert.EqualError(t, err, "calc index 7 out of range, max 4")
+}
+
+func TestDefaultIndex(t *testing.T) {
+	b := newCommandsBot(t)
+	b.conf.DefaultVersions = map[string]string{"#other": versionNewest}
+	require.NoError(t, b.initVersions())
+	assert.Equal(t, "0", b.defaultIndex("#test"))
+	assert.Equal(t, "-1", b.defaultIndex("#OTHER"))
+
+	b.conf.DefaultVersions = map[string]string{"#other": versionRated}
+	assert.Error(t, b.initVersions())
+
+	b.conf.DefaultVersions = map[string]string{"#nope": versionNewest}
+	assert.Error(t, b.initVersions())
+}
+
+func TestCalcVersionsLimit(t *testing.T) {
+	b := newCommandsBot(t)
+	// the range is rejected before the versions are fetched
+	_, _, err := b.calcVersions(repository.IrcCalc{}, 500, "0..-1")
+	assert.EqualError(t, err, "calc range 0..-1 has 500 versions, at most 6 are shown")
+
+	require.NoError(t, b.checkShown("0..5", 0, 5))
+}
@@ -0,0 +1,279 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/adzip-kadum/irc-calc/log"
+)
+
+const (
+	defaultReads       = 10
+	defaultWrites      = 3
+	defaultLimitPeriod = time.Minute
+	defaultIgnoreAfter = 3
+	defaultIgnoreFor   = 10 * time.Minute
+
+	limitsCleanupInterval = time.Minute
+)
+
+// RateLimitConfig limits the commands a nick or a host may run per period.
+// Offenders exceeding the limit IgnoreAfter times in a period are ignored.
+type RateLimitConfig struct {
+	Reads       int           `yaml:"reads"`
+	Writes      int           `yaml:"writes"`
+	Period      time.Duration `yaml:"period"`
+	IgnoreAfter int           `yaml:"ignoreAfter"`
+	IgnoreFor   time.Duration `yaml:"ignoreFor"`
+}
+
+// withDefaults fills the zero fields from the defaults.
+func (c RateLimitConfig) withDefaults(defaults RateLimitConfig) RateLimitConfig {
+	if c.Reads == 0 {
+		c.Reads = defaults.Reads
+	}
+	if c.Writes == 0 {
+		c.Writes = defaults.Writes
+	}
+	if c.Period == 0 {
+		c.Period = defaults.Period
+	}
+	if c.IgnoreAfter == 0 {
+		c.IgnoreAfter = defaults.IgnoreAfter
+	}
+	if c.IgnoreFor == 0 {
+		c.IgnoreFor = defaults.IgnoreFor
+	}
+	return c
+}
+
+// initRateLimits fills the rate limits of the channels.
+func (b *Bot) initRateLimits() error {
+	b.conf.RateLimit = b.conf.RateLimit.withDefaults(RateLimitConfig{
+		Reads:       defaultReads,
+		Writes:      defaultWrites,
+		Period:      defaultLimitPeriod,
+		IgnoreAfter: defaultIgnoreAfter,
+		IgnoreFor:   defaultIgnoreFor,
+	})
+	for channel, limit := range b.conf.RateLimits {
+		if b.channel(channel) == "" {
+			return errors.Errorf("rate limit for unknown channel %q", channel)
+		}
+		b.conf.RateLimits[channel] = limit.withDefaults(b.conf.RateLimit)
+	}
+	return nil
+}
+
+// rateLimit returns the rate limit of the channel.
+func (b *Bot) rateLimit(channel string) RateLimitConfig {
+	for name, limit := range b.conf.RateLimits {
+		if strings.EqualFold(name, channel) {
+			return limit
+		}
+	}
+	return b.conf.RateLimit
+}
+
+type verdict int
+
+const (
+	allowed verdict = iota
+	// over the limit, the nick is warned once per period
+	limited
+	silenced
+)
+
+type offence struct {
+	count int
+	since time.Time
+}
+
+// limiter keeps a bucket per channel, kind of command and identity, i.e. a
+// nick or a host, and the identities ignored.
+type limiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	offences map[string]*offence
+	ignored  map[string]time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		buckets:  map[string]*bucket{},
+		offences: map[string]*offence{},
+		ignored:  map[string]time.Time{},
+	}
+}
+
+func identities(req request) []string {
+	ids := []string{"nick:" + strings.ToLower(req.nick)}
+	if req.host != "" {
+		ids = append(ids, "host:"+strings.ToLower(req.host))
+	}
+	return ids
+}
+
+// isIgnored reports whether the nick or the host of the request is ignored.
+func (l *limiter) isIgnored(req request, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range identities(req) {
+		if until, ok := l.ignored[id]; ok && now.Before(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// exhausted reports whether the nick or the host of the request has no read
+// token left in the channel, without taking one.
+func (l *limiter) exhausted(req request, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range identities(req) {
+		key := strings.Join([]string{strings.ToLower(req.channel), "read", id}, " ")
+		if tb, ok := l.buckets[key]; ok && tb.delay(now) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// check takes a token for the nick and the host of the request. Every
+// request over the limit is an offence, too many of them get the nick and
+// the host ignored.
+func (l *limiter) check(conf RateLimitConfig, req request, write bool, now time.Time) verdict {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kind, limit := "read", conf.Reads
+	if write {
+		kind, limit = "write", conf.Writes
+	}
+	ids := identities(req)
+	buckets := make([]*bucket, 0, len(ids))
+	for _, id := range ids {
+		key := strings.Join([]string{strings.ToLower(req.channel), kind, id}, " ")
+		tb, ok := l.buckets[key]
+		if !ok {
+			tb = newBucket(conf.Period/time.Duration(limit), limit, now)
+			l.buckets[key] = tb
+		}
+		if tb.delay(now) > 0 {
+			return l.offend(conf, ids, now)
+		}
+		buckets = append(buckets, tb)
+	}
+	for _, tb := range buckets {
+		tb.take(now)
+	}
+	return allowed
+}
+
+func (l *limiter) offend(conf RateLimitConfig, ids []string, now time.Time) verdict {
+	verdict := silenced
+	for _, id := range ids {
+		o, ok := l.offences[id]
+		if !ok || now.Sub(o.since) > conf.Period {
+			o = &offence{since: now}
+			l.offences[id] = o
+			verdict = limited
+		}
+		o.count++
+		if o.count >= conf.IgnoreAfter {
+			l.ignored[id] = now.Add(conf.IgnoreFor)
+			delete(l.offences, id)
+			log.Info("ignoring", log.String("id", id), log.Duration("for", conf.IgnoreFor))
+		}
+	}
+	return verdict
+}
+
+// cleanup forgets the full buckets and the expired offences and ignores.
+func (l *limiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, tb := range l.buckets {
+		tb.refill(now)
+		if tb.tokens >= tb.burst {
+			delete(l.buckets, key)
+		}
+	}
+	for id, until := range l.ignored {
+		if !now.Before(until) {
+			delete(l.ignored, id)
+		}
+	}
+	for id, o := range l.offences {
+		if now.Sub(o.since) > time.Hour {
+			delete(l.offences, id)
+		}
+	}
+}
+
+// list returns the ignored identities with the time they are ignored until.
+func (l *limiter) list(now time.Time) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ignored []string
+	for id, until := range l.ignored {
+		if now.Before(until) {
+			ignored = append(ignored, fmt.Sprintf("%s until %s", id, until.UTC().Format("15:04:05")))
+		}
+	}
+	sort.Strings(ignored)
+	return ignored
+}
+
+// clear stops ignoring the nick or the host, or everyone with "all". It
+// reports how many identities were ignored.
+func (l *limiter) clear(name string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cleared := 0
+	name = strings.ToLower(name)
+	for id := range l.ignored {
+		if name == "all" || id == "nick:"+name || id == "host:"+name {
+			delete(l.ignored, id)
+			delete(l.offences, id)
+			cleared++
+		}
+	}
+	return cleared
+}
+
+// limit applies the rate limit of the channel to the command. Admins are
+// not limited.
+func (b *Bot) limit(req request, cmd *command, args string) verdict {
+	if b.isAdmin(req) {
+		return allowed
+	}
+	return b.limits.check(b.rateLimit(req.channel), req, cmd.writes(args), req.when)
+}
+
+// limitsCommand lists the ignored nicks and hosts or stops ignoring them:
+// "!calc-limits clear nick".
+func (b *Bot) limitsCommand(req request, data string) (string, error) {
+	args := strings.Fields(data)
+	if len(args) == 0 {
+		ignored := b.limits.list(time.Now())
+		if len(ignored) == 0 {
+			return "nobody is ignored", nil
+		}
+		return "ignored: " + strings.Join(ignored, ", "), nil
+	}
+	if len(args) != 2 || args[0] != "clear" {
+		return "usage: " + b.usage(req.channel, b.commands.lookup("limits")), nil
+	}
+	return fmt.Sprintf("%d ignore(s) cleared by %s", b.limits.clear(args[1]), req.nick), nil
+}
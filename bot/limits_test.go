@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	conf := RateLimitConfig{Reads: 2, Writes: 1, Period: time.Minute, IgnoreAfter: 3, IgnoreFor: time.Hour}
+	l := newLimiter()
+	now := time.Now()
+	req := request{nick: "User", host: "host", channel: "#test"}
+
+	assert.Equal(t, allowed, l.check(conf, req, false, now))
+	assert.Equal(t, allowed, l.check(conf, req, false, now))
+	assert.Equal(t, allowed, l.check(conf, req, true, now))
+	assert.Equal(t, limited, l.check(conf, req, true, now))
+	assert.Equal(t, silenced, l.check(conf, req, true, now))
+	// another channel
+	assert.Equal(t, allowed, l.check(conf, request{nick: "user", host: "host", channel: "#other"}, false, now))
+	// a token is back
+	later := now.Add(30 * time.Second)
+	assert.Equal(t, allowed, l.check(conf, req, false, later))
+	assert.False(t, l.isIgnored(req, later))
+
+	// the third offence of the host, another nick is warned once
+	other := request{nick: "other", host: "HOST", channel: "#test"}
+	assert.Equal(t, limited, l.check(conf, other, false, later))
+	assert.True(t, l.isIgnored(request{nick: "third", host: "host"}, later))
+	assert.False(t, l.isIgnored(request{nick: "user"}, later))
+	assert.False(t, l.isIgnored(req, later.Add(2*time.Hour)))
+
+	until := later.Add(time.Hour).UTC().Format("15:04:05")
+	assert.Equal(t, []string{"host:host until " + until}, l.list(later))
+	assert.Equal(t, 0, l.clear("user"))
+	assert.Equal(t, 1, l.clear("HOST"))
+	assert.False(t, l.isIgnored(req, later))
+}
+
+func TestLimitsCommand(t *testing.T) {
+	b := newCommandsBot(t)
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		b.handle(request{nick: "user", channel: "#test", when: now}, "!calc-eval 1")
+	}
+	reply, err := b.handle(request{nick: "user", channel: "#test", when: now}, "!calc-eval 1")
+	require.NoError(t, err)
+	assert.Equal(t, "", reply)
+
+	reply, err = b.handle(request{nick: "boss", account: "boss", channel: "#test", when: now}, "!calc-limits")
+	require.NoError(t, err)
+	assert.Contains(t, reply, "ignored: nick:user until ")
+
+	reply, err = b.handle(request{nick: "boss", account: "boss", channel: "#test", when: now}, "!calc-limits clear user")
+	require.NoError(t, err)
+	assert.Equal(t, "1 ignore(s) cleared by boss", reply)
+
+	reply, err = b.handle(request{nick: "user", channel: "#test", when: now}, "!calc-eval 1")
+	require.NoError(t, err)
+	assert.Equal(t, "user: too many requests, slow down", reply)
+}
+
+func TestInitRateLimits(t *testing.T) {
+	b := &Bot{conf: Config{
+		Channels:   []string{"#test"},
+		RateLimit:  RateLimitConfig{Reads: 5},
+		RateLimits: map[string]RateLimitConfig{"#TEST": {Writes: 1}},
+	}}
+	require.NoError(t, b.initRateLimits())
+	assert.Equal(t, RateLimitConfig{Reads: 5, Writes: 1, Period: defaultLimitPeriod,
+		IgnoreAfter: defaultIgnoreAfter, IgnoreFor: defaultIgnoreFor}, b.rateLimit("#test"))
+	assert.Equal(t, defaultWrites, b.rateLimit("#other").Writes)
+
+	b.conf.RateLimits = map[string]RateLimitConfig{"#nope": {}}
+	assert.Error(t, b.initRateLimits())
+}
@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+const rplNamReply = "353"
+
+// members tracks nicks present in the channels the bot joined. Nicks are
+// kept as they come from the server, i.e. encoded.
+type members struct {
+	mu       sync.Mutex
+	channels map[string]map[string]struct{}
+}
+
+func newMembers() *members {
+	return &members{
+		channels: map[string]map[string]struct{}{},
+	}
+}
+
+// trigger updates the membership on NAMES replies, joins, parts, kicks,
+// quits and nick changes. It never consumes the message.
+func (ms *members) trigger() hbot.Trigger {
+	return hbot.Trigger{
+		Condition: func(bot *hbot.Bot, m *hbot.Message) bool {
+			switch m.Command {
+			case rplNamReply, "JOIN", "PART", "KICK", "QUIT", "NICK":
+				return true
+			}
+			return false
+		},
+		Action: func(bot *hbot.Bot, m *hbot.Message) bool {
+			ms.update(bot.Nick, m)
+			return false
+		},
+	}
+}
+
+func (ms *members) update(me string, m *hbot.Message) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	switch m.Command {
+	case rplNamReply:
+		// :server 353 me = #channel :nick1 @nick2 +nick3
+		channel := strings.ToLower(m.Param(2))
+		for _, nick := range strings.Fields(m.Param(3)) {
+			ms.add(channel, strings.TrimLeft(nick, "~&@%+"))
+		}
+	case "JOIN":
+		ms.add(strings.ToLower(m.Param(0)), m.From)
+	case "PART":
+		channel := strings.ToLower(m.Param(0))
+		if m.From == me {
+			delete(ms.channels, channel)
+			return
+		}
+		delete(ms.channels[channel], m.From)
+	case "KICK":
+		channel := strings.ToLower(m.Param(0))
+		if m.Param(1) == me {
+			delete(ms.channels, channel)
+			return
+		}
+		delete(ms.channels[channel], m.Param(1))
+	case "QUIT":
+		for _, nicks := range ms.channels {
+			delete(nicks, m.From)
+		}
+	case "NICK":
+		for _, nicks := range ms.channels {
+			if _, ok := nicks[m.From]; ok {
+				delete(nicks, m.From)
+				nicks[m.Param(0)] = struct{}{}
+			}
+		}
+	}
+}
+
+// reset forgets everything, e.g. after a reconnect.
+func (ms *members) reset() {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.channels = map[string]map[string]struct{}{}
+}
+
+func (ms *members) add(channel, nick string) {
+	if nick == "" {
+		return
+	}
+	nicks, ok := ms.channels[channel]
+	if !ok {
+		nicks = map[string]struct{}{}
+		ms.channels[channel] = nicks
+	}
+	nicks[nick] = struct{}{}
+}
+
+// has reports whether the nick is present in the channel. Nicks are case
+// insensitive.
+func (ms *members) has(channel, nick string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	for n := range ms.channels[strings.ToLower(channel)] {
+		if strings.EqualFold(n, nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// random returns a random nick present in the channel or an empty string.
+func (ms *members) random(channel string) string {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	nicks := ms.channels[strings.ToLower(channel)]
+	if len(nicks) == 0 {
+		return ""
+	}
+	n := rand.Intn(len(nicks))
+	for nick := range nicks {
+		if n == 0 {
+			return nick
+		}
+		n--
+	}
+	return ""
+}
@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxReplyLines = 3
+
+	// continues the reply, without the prefix it is answered only if there
+	// is something to continue
+	moreCommand = "!more"
+	moreMark    = " [!more]"
+	moreTTL     = 10 * time.Minute
+
+	maxLineBytes = 512
+	// the server prepends ":nick!user@host " to the lines it relays
+	hostmaskReserve = 100
+)
+
+// stringEncoder encodes text, like encoding.Encoder.
+type stringEncoder interface {
+	String(text string) (string, error)
+}
+
+// line is a line of a reply and its encoded form.
+type line struct {
+	text    string
+	encoded string
+}
+
+// lineLimit returns how many encoded bytes of text fit into a line sent to
+// the target.
+func lineLimit(target string) int {
+	return maxLineBytes - len("\r\n") - len("PRIVMSG "+target+" :") - hostmaskReserve
+}
+
+// splitReply splits the text into lines of at most limit bytes once encoded.
+// Lines are split between words, words longer than a line are split between
+// characters.
+func splitReply(text string, limit int, encoder stringEncoder) ([]line, error) {
+	var lines []line
+	for _, paragraph := range strings.Split(text, "\n") {
+		var current line
+		flush := func() {
+			lines = append(lines, current)
+			current = line{}
+		}
+		for _, word := range strings.Split(paragraph, " ") {
+			encoded, err := encoder.String(word)
+			if err != nil {
+				return nil, err
+			}
+			if current.encoded != "" && len(current.encoded)+1+len(encoded) > limit {
+				flush()
+			}
+			if len(encoded) > limit {
+				chunks, err := splitWord(word, limit, encoder)
+				if err != nil {
+					return nil, err
+				}
+				if current.encoded != "" {
+					flush()
+				}
+				for _, chunk := range chunks[:len(chunks)-1] {
+					current = chunk
+					flush()
+				}
+				current = chunks[len(chunks)-1]
+				continue
+			}
+			if current.encoded != "" || current.text != "" {
+				current.text += " "
+				current.encoded += " "
+			}
+			current.text += word
+			current.encoded += encoded
+		}
+		flush()
+	}
+	return lines, nil
+}
+
+// splitWord splits the word between characters into chunks of at most limit
+// bytes once encoded.
+func splitWord(word string, limit int, encoder stringEncoder) ([]line, error) {
+	var chunks []line
+	var current line
+	for len(word) > 0 {
+		_, size := utf8.DecodeRuneInString(word)
+		encoded, err := encoder.String(word[:size])
+		if err != nil {
+			return nil, err
+		}
+		if len(current.encoded)+len(encoded) > limit && current.encoded != "" {
+			chunks = append(chunks, current)
+			current = line{}
+		}
+		current.text += word[:size]
+		current.encoded += encoded
+		word = word[size:]
+	}
+	return append(chunks, current), nil
+}
+
+// pending is the rest of a reply kept for !more.
+type pending struct {
+	text  string
+	until time.Time
+}
+
+// moreBuffer keeps the rest of the last long reply to every nick.
+type moreBuffer struct {
+	mu     sync.Mutex
+	byNick map[string]pending
+}
+
+func newMoreBuffer() *moreBuffer {
+	return &moreBuffer{
+		byNick: map[string]pending{},
+	}
+}
+
+// put keeps the text for the nick, an empty text forgets what was kept.
+func (mb *moreBuffer) put(nick, text string, now time.Time) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for n, p := range mb.byNick {
+		if now.After(p.until) {
+			delete(mb.byNick, n)
+		}
+	}
+	nick = strings.ToLower(nick)
+	if text == "" {
+		delete(mb.byNick, nick)
+		return
+	}
+	mb.byNick[nick] = pending{text: text, until: now.Add(moreTTL)}
+}
+
+func (mb *moreBuffer) take(nick string, now time.Time) (string, bool) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	nick = strings.ToLower(nick)
+	p, ok := mb.byNick[nick]
+	delete(mb.byNick, nick)
+	if !ok || now.After(p.until) {
+		return "", false
+	}
+	return p.text, true
+}
+
+func (mb *moreBuffer) has(nick string, now time.Time) bool {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	p, ok := mb.byNick[strings.ToLower(nick)]
+	return ok && !now.After(p.until)
+}
+
+// moreReply continues the last long reply to the nick.
+func (b *Bot) moreReply(req request, _ string) (string, error) {
+	text, ok := b.more.take(req.nick, req.when)
+	if !ok {
+		return "nothing more", nil
+	}
+	return text, nil
+}
+
+// reply sends the first lines of the text to the target and keeps the rest
+// for !more.
+func (b *Bot) reply(s *session, target string, req request, text string) error {
+	lines, err := splitReply(text, lineLimit(target)-len(moreMark), b.encoderFor(req.charset))
+	if err != nil {
+		return err
+	}
+	var rest []string
+	if len(lines) > b.conf.MaxReplyLines {
+		for _, l := range lines[b.conf.MaxReplyLines:] {
+			rest = append(rest, l.text)
+		}
+		lines = lines[:b.conf.MaxReplyLines]
+		lines[len(lines)-1].encoded += moreMark
+	}
+	b.more.put(req.nick, strings.Join(rest, "\n"), req.when)
+
+	for _, l := range lines {
+		s.queue.push("PRIVMSG " + target + " :" + l.encoded)
+	}
+	return nil
+}
+
+// send sends the text to the target in the charset, every line of it.
+func (b *Bot) send(s *session, target string, cs *charset, text string) error {
+	lines, err := splitReply(text, lineLimit(target), b.encoderFor(cs))
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		s.queue.push("PRIVMSG " + target + " :" + l.encoded)
+	}
+	return nil
+}
+
+// encoderFor returns an encoder of the charset, the default one if it is nil,
+// applying the unencodable policy.
+func (b *Bot) encoderFor(cs *charset) stringEncoder {
+	if cs == nil {
+		cs = b.charset
+	}
+	return fallbackEncoder{encoder: cs.encoding.NewEncoder(), policy: b.conf.Unencodable}
+}
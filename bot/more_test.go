@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func texts(lines []line) []string {
+	result := make([]string, 0, len(lines))
+	for _, l := range lines {
+		result = append(result, l.text)
+	}
+	return result
+}
+
+func TestSplitReply(t *testing.T) {
+	koi8r := charmap.KOI8R.NewEncoder()
+
+	lines, err := splitReply("один два три\nчетыре", 8, koi8r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"один два", "три", "четыре"}, texts(lines))
+	for _, l := range lines {
+		assert.True(t, len(l.encoded) <= 8)
+	}
+	assert.Equal(t, "\xcf\xc4\xc9\xce \xc4\xd7\xc1", lines[0].encoded)
+
+	lines, err = splitReply("a verylongword b", 5, koi8r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "veryl", "ongwo", "rd b"}, texts(lines))
+
+	// never splits a character
+	lines, err = splitReply("привет", 5, unicode.UTF8.NewEncoder())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"пр", "ив", "ет"}, texts(lines))
+
+	_, err = splitReply("日本", 100, koi8r)
+	assert.Error(t, err)
+}
+
+func TestMoreBuffer(t *testing.T) {
+	mb := newMoreBuffer()
+	now := time.Now()
+
+	mb.put("Nick", "rest", now)
+	assert.True(t, mb.has("nick", now))
+	assert.False(t, mb.has("nick", now.Add(moreTTL+time.Second)))
+
+	text, ok := mb.take("NICK", now)
+	assert.True(t, ok)
+	assert.Equal(t, "rest", text)
+	_, ok = mb.take("nick", now)
+	assert.False(t, ok)
+
+	mb.put("nick", "rest", now)
+	mb.put("nick", "", now)
+	assert.False(t, mb.has("nick", now))
+}
+
+func TestReply(t *testing.T) {
+	b := newCommandsBot(t)
+	b.conf.MaxReplyLines = 2
+	s := &session{queue: b.newQueue(nil)}
+	req := request{nick: "user", channel: "#test", when: time.Now()}
+	limit := lineLimit("#test") - len(moreMark)
+
+	word := strings.Repeat("ж", limit)
+	require.NoError(t, b.reply(s, "#test", req, strings.Join([]string{word, word, word, "end"}, " ")))
+	var sent []string
+	for {
+		line, ok := s.queue.pop()
+		if !ok {
+			break
+		}
+		sent = append(sent, line)
+	}
+	require.Len(t, sent, 2)
+	assert.True(t, strings.HasSuffix(sent[1], moreMark))
+
+	reply, err := b.handle(req, "!calc-more")
+	require.NoError(t, err)
+	assert.Equal(t, word+"\nend", reply)
+	reply, err = b.handle(req, "!calc-more")
+	require.NoError(t, err)
+	assert.Equal(t, "nothing more", reply)
+}
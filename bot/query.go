@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+// channel names start with these
+const channelMarks = "#&"
+
+// isQuery reports whether the message was sent to the bot privately. CTCP
+// requests are not queries.
+func isQuery(irc *hbot.Bot, m *hbot.Message) bool {
+	return strings.EqualFold(m.To, irc.Nick) && !strings.HasPrefix(m.Content, "\x01")
+}
+
+// query parses a private message: "[#channel] key" or "[#channel] !calc-help".
+// The channel defaults to the first one configured, the prefix is optional
+// for getting and setting calcs. The global namespace is addressed by its
+// name in place of the channel, it is the only way to fill it.
+func (b *Bot) query(data string) (channel, content string, err error) {
+	data = strings.TrimSpace(data)
+	channel = b.conf.Channels[0]
+	if data != "" {
+		parts := strings.SplitN(data, " ", 2)
+		switch {
+		case b.conf.Global != "" && strings.EqualFold(parts[0], b.conf.Global):
+			channel = b.conf.Global
+		case strings.ContainsRune(channelMarks, rune(data[0])):
+			channel = b.channel(parts[0])
+			if channel == "" {
+				return "", "", errors.Errorf("%s is not served", parts[0])
+			}
+		default:
+			parts = nil
+		}
+		if parts != nil {
+			data = ""
+			if len(parts) > 1 {
+				data = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	prefix := b.prefix(channel)
+	if name, _, ok := parseCommand(prefix, data); !ok || b.commands.lookup(name) == nil {
+		data = prefix + " " + data
+	}
+	return channel, data, nil
+}
+
+// isMember reports whether the nick is present in the channel.
+func (b *Bot) isMember(channel, nick string) bool {
+	encoded, err := b.charset.encode(nick)
+	if err != nil {
+		return false
+	}
+	return b.members.has(channel, encoded)
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	hbot "github.com/whyrusleeping/hellabot"
+)
+
+func TestQuery(t *testing.T) {
+	b := newCommandsBot(t)
+	for data, want := range map[string][]string{
+		"key":               {"#test", "!calc key"},
+		" key = value ":     {"#test", "!calc key = value"},
+		"#OTHER key":        {"#other", "?c key"},
+		"#other ?c-help":    {"#other", "?c-help"},
+		"!calc-history key": {"#test", "!calc-history key"},
+		"!calc-nope key":    {"#test", "!calc !calc-nope key"},
+		"#other !calc-help": {"#other", "?c !calc-help"},
+		"#test":             {"#test", "!calc "},
+		"&test key":         nil,
+		"#unknown some key": nil,
+	} {
+		channel, content, err := b.query(data)
+		if want == nil {
+			assert.Error(t, err, data)
+			continue
+		}
+		require.NoError(t, err, data)
+		assert.Equal(t, want[0], channel, data)
+		assert.Equal(t, want[1], content, data)
+	}
+}
+
+func TestQueryGlobal(t *testing.T) {
+	b := newCommandsBot(t)
+	b.conf.Global = "*"
+
+	channel, content, err := b.query("* key = value")
+	require.NoError(t, err)
+	assert.Equal(t, "*", channel)
+	assert.Equal(t, "!calc key = value", content)
+
+	channel, content, err = b.query("*key")
+	require.NoError(t, err)
+	assert.Equal(t, "#test", channel)
+	assert.Equal(t, "!calc *key", content)
+
+	// only admins fill the global namespace
+	global := request{nick: "user", channel: "*", private: true}
+	assert.EqualError(t, b.allowed(global, member), "user is not an admin, only admins change *")
+	global.account = "boss"
+	assert.NoError(t, b.allowed(global, member))
+}
+
+func TestIsQuery(t *testing.T) {
+	irc := &hbot.Bot{Nick: "calc"}
+	assert.True(t, isQuery(irc, &hbot.Message{To: "Calc", Content: "key"}))
+	assert.False(t, isQuery(irc, &hbot.Message{To: "#test", Content: "!calc key"}))
+	assert.False(t, isQuery(irc, &hbot.Message{To: "calc", Content: "\x01VERSION\x01"}))
+}
+
+func TestAllowed(t *testing.T) {
+	b := newCommandsBot(t)
+	b.members.update("calc", hbot.ParseMessage(":User!user@host JOIN #test"))
+
+	assert.NoError(t, b.allowed(request{nick: "stranger", channel: "#test"}, member))
+	assert.NoError(t, b.allowed(request{nick: "user", channel: "#test", private: true}, member))
+	assert.NoError(t, b.allowed(request{nick: "boss", account: "boss", channel: "#test", private: true}, member))
+	assert.EqualError(t, b.allowed(request{nick: "user", channel: "#other", private: true}, member),
+		"user is not in #other")
+	assert.EqualError(t, b.allowed(request{nick: "stranger", channel: "#test", private: true}, member),
+		"stranger is not in #test")
+	assert.EqualError(t, b.allowed(request{nick: "user", channel: "#test"}, adminOnly),
+		"user is not an admin")
+
+	_, err := b.handle(request{nick: "stranger", channel: "#test", private: true}, "!calc-forget key")
+	assert.EqualError(t, err, "stranger is not in #test")
+	_, err = b.handle(request{nick: "stranger", channel: "#test", private: true}, "!calc key = value")
+	assert.EqualError(t, err, "stranger is not in #test")
+}
@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	hbot "github.com/whyrusleeping/hellabot"
+	"go.uber.org/atomic"
+
+	"github.com/adzip-kadum/irc-calc/log"
+)
+
+const (
+	// servers commonly add 2 seconds to the client timer per message and drop
+	// clients running more than 10 seconds ahead
+	defaultFloodRate  = 2 * time.Second
+	defaultFloodBurst = 5
+	defaultQueueSize  = 100
+
+	queueStatsInterval = time.Minute
+)
+
+// QueueStats are the metrics of the outgoing queue.
+type QueueStats struct {
+	// messages waiting to be sent over the current connection
+	Length  int
+	Sent    int64
+	Dropped int64
+}
+
+// QueueStats returns the metrics of the outgoing queue.
+func (b *Bot) QueueStats() QueueStats {
+	stats := QueueStats{
+		Sent:    b.sent.Load(),
+		Dropped: b.dropped.Load(),
+	}
+	if s := b.currentSession(); s != nil {
+		stats.Length = s.queue.len()
+	}
+	return stats
+}
+
+func (b *Bot) logQueueStats() {
+	stats := b.QueueStats()
+	log.Debug("outgoing queue",
+		log.String("nick", b.conf.Nickname),
+		log.Int("length", stats.Length),
+		log.Int64("sent", stats.Sent),
+		log.Int64("dropped", stats.Dropped),
+	)
+}
+
+// bucket is a token bucket refilled with a token per rate up to burst tokens.
+type bucket struct {
+	rate   time.Duration
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate time.Duration, burst int, now time.Time) *bucket {
+	return &bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (tb *bucket) refill(now time.Time) {
+	tb.tokens += float64(now.Sub(tb.last)) / float64(tb.rate)
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// delay returns how long to wait for a token.
+func (tb *bucket) delay(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) * float64(tb.rate))
+}
+
+func (tb *bucket) take(now time.Time) {
+	tb.refill(now)
+	tb.tokens--
+}
+
+// queue paces the outgoing messages of a connection. Control messages go
+// first, messages to channels and nicks are sent in turns, one per target.
+// Messages over the size of the queue are dropped, control messages never
+// are.
+type queue struct {
+	send    func(line string)
+	size    int
+	sent    *atomic.Int64
+	dropped *atomic.Int64
+
+	// used by run only
+	bucket *bucket
+
+	mu       sync.Mutex
+	control  []string
+	targets  []string
+	byTarget map[string][]string
+	length   int
+	wake     chan struct{}
+}
+
+func (b *Bot) newQueue(send func(line string)) *queue {
+	return &queue{
+		send:     send,
+		size:     b.conf.QueueSize,
+		sent:     b.sent,
+		dropped:  b.dropped,
+		bucket:   newBucket(b.conf.FloodRate, b.conf.FloodBurst, time.Now()),
+		byTarget: map[string][]string{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// push queues the line, PRIVMSG and NOTICE are queued by their target and
+// the rest are control messages.
+func (q *queue) push(line string) {
+	command, target := line, ""
+	if parts := strings.SplitN(line, " ", 3); len(parts) > 1 {
+		command, target = parts[0], strings.ToLower(parts[1])
+	}
+	if command != "PRIVMSG" && command != "NOTICE" {
+		q.pushControl(line)
+		return
+	}
+
+	q.mu.Lock()
+	if q.length >= q.size {
+		q.mu.Unlock()
+		q.dropped.Inc()
+		log.Info("outgoing queue is full, message dropped", log.String("target", target))
+		return
+	}
+	if _, ok := q.byTarget[target]; !ok {
+		q.targets = append(q.targets, target)
+	}
+	q.byTarget[target] = append(q.byTarget[target], line)
+	q.length++
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+// pushControl queues the line ahead of the messages.
+func (q *queue) pushControl(line string) {
+	q.mu.Lock()
+	q.control = append(q.control, line)
+	q.length++
+	q.mu.Unlock()
+
+	q.notify()
+}
+
+func (q *queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.length
+}
+
+// pop returns the next line to send.
+func (q *queue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.control) > 0 {
+		line := q.control[0]
+		q.control = q.control[1:]
+		q.length--
+		return line, true
+	}
+	if len(q.targets) == 0 {
+		return "", false
+	}
+	target := q.targets[0]
+	lines := q.byTarget[target]
+	q.targets = q.targets[1:]
+	if len(lines) > 1 {
+		q.byTarget[target] = lines[1:]
+		q.targets = append(q.targets, target)
+	} else {
+		delete(q.byTarget, target)
+	}
+	q.length--
+	return lines[0], true
+}
+
+// run sends the queued lines as the bucket allows until done is closed. The
+// lines left are dropped.
+func (q *queue) run(done <-chan struct{}) {
+	defer func() {
+		q.dropped.Add(int64(q.len()))
+	}()
+
+	for {
+		if q.len() == 0 {
+			select {
+			case <-q.wake:
+				continue
+			case <-done:
+				return
+			}
+		}
+
+		if delay := q.bucket.delay(time.Now()); delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-done:
+				return
+			}
+			continue
+		}
+
+		line, ok := q.pop()
+		if !ok {
+			continue
+		}
+		q.bucket.take(time.Now())
+		q.send(line)
+		q.sent.Inc()
+	}
+}
+
+// replyTarget returns where to answer the message, like hbot.Bot.Reply.
+func replyTarget(m *hbot.Message) string {
+	if !strings.Contains(m.To, "#") {
+		return m.From
+	}
+	return m.To
+}
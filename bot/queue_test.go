@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func newTestQueue(send func(string), rate time.Duration, burst, size int) *queue {
+	b := &Bot{
+		conf:    Config{FloodRate: rate, FloodBurst: burst, QueueSize: size},
+		sent:    atomic.NewInt64(0),
+		dropped: atomic.NewInt64(0),
+	}
+	return b.newQueue(send)
+}
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	tb := newBucket(2*time.Second, 2, now)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, time.Duration(0), tb.delay(now))
+		tb.take(now)
+	}
+	assert.Equal(t, 2*time.Second, tb.delay(now))
+	assert.Equal(t, time.Second, tb.delay(now.Add(time.Second)))
+	assert.Equal(t, time.Duration(0), tb.delay(now.Add(2*time.Second)))
+
+	// refills up to the burst only
+	assert.Equal(t, time.Duration(0), tb.delay(now.Add(time.Hour)))
+	tb.take(now.Add(time.Hour))
+	tb.take(now.Add(time.Hour))
+	assert.Equal(t, 2*time.Second, tb.delay(now.Add(time.Hour)))
+}
+
+func TestQueueOrder(t *testing.T) {
+	q := newTestQueue(nil, time.Second, 1, 4)
+	q.push("PRIVMSG #a :1")
+	q.push("PRIVMSG #a :2")
+	q.push("PRIVMSG #A :3")
+	q.push("PRIVMSG nick :1")
+	q.push("PRIVMSG nick :2")
+	q.pushControl("PRIVMSG NickServ :IDENTIFY secret")
+	q.push("PONG :server")
+	assert.Equal(t, 6, q.len())
+	assert.Equal(t, int64(1), q.dropped.Load())
+
+	var lines []string
+	for {
+		line, ok := q.pop()
+		if !ok {
+			break
+		}
+		lines = append(lines, line)
+	}
+	assert.Equal(t, []string{
+		"PRIVMSG NickServ :IDENTIFY secret",
+		"PONG :server",
+		"PRIVMSG #a :1",
+		"PRIVMSG nick :1",
+		"PRIVMSG #a :2",
+		"PRIVMSG #A :3",
+	}, lines)
+	assert.Equal(t, 0, q.len())
+}
+
+func TestQueueRun(t *testing.T) {
+	sent := make(chan string, 10)
+	q := newTestQueue(func(line string) { sent <- line }, 50*time.Millisecond, 2, 10)
+	done := make(chan struct{})
+	go q.run(done)
+
+	start := time.Now()
+	for _, line := range []string{"1", "2", "3"} {
+		q.push("PRIVMSG #test :" + line)
+	}
+	for _, want := range []string{"1", "2", "3"} {
+		select {
+		case line := <-sent:
+			assert.Equal(t, "PRIVMSG #test :"+want, line)
+		case <-time.After(time.Second):
+			require.Fail(t, "not sent", want)
+		}
+	}
+	// the third one waits for a token
+	assert.True(t, time.Since(start) >= 40*time.Millisecond)
+	assert.Equal(t, int64(3), q.sent.Load())
+
+	close(done)
+}
@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	// calcs picked within the window are not picked again, unless there are
+	// no others
+	defaultRandomWindow = 30 * 24 * time.Hour
+
+	dailyCheckInterval = time.Minute
+	// the picks older than the window are deleted
+	picksCleanupInterval = time.Hour
+
+	pickRandom = "random"
+	pickDaily  = "daily"
+
+	// shorter patterns have no trigrams to look the keys up by
+	minRandomPattern = 3
+)
+
+// initDaily parses the time of the calc of the day, "15:04" UTC.
+func (b *Bot) initDaily() error {
+	if b.conf.RandomWindow == 0 {
+		b.conf.RandomWindow = defaultRandomWindow
+	}
+	if b.conf.CalcOfTheDay == "" {
+		return nil
+	}
+	at, err := time.Parse("15:04", b.conf.CalcOfTheDay)
+	if err != nil {
+		return errors.Wrapf(err, "invalid calc of the day time %q", b.conf.CalcOfTheDay)
+	}
+	b.dailyAt = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	return nil
+}
+
+// dailyDue returns the start of the day if the calc of the day is due by now.
+func (b *Bot) dailyDue(now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return day, b.conf.CalcOfTheDay != "" && !now.Before(day.Add(b.dailyAt))
+}
+
+// pickCalc picks a random calc of the channel with the key containing the
+// pattern, avoiding the calcs picked recently, and records the pick.
+func (b *Bot) pickCalc(channel, pattern, kind string, now time.Time) (repository.IrcCalc, bool, error) {
+	ctx := context.Background()
+	c, ok, err := b.repo.GetRandomCalc(ctx, channel, pattern, now.UTC().Add(-b.conf.RandomWindow))
+	if err == nil && !ok {
+		// every calc was picked recently
+		c, ok, err = b.repo.GetRandomCalc(ctx, channel, pattern, now.UTC())
+	}
+	if err != nil || !ok {
+		return c, ok, err
+	}
+	err = b.repo.AddCalcPick(ctx, repository.AddCalcPickParams{
+		Channel: channel,
+		NormKey: c.NormKey,
+		Kind:    kind,
+		When:    now.UTC(),
+	})
+	return c, true, err
+}
+
+// randomCalc shows the newest version of a random calc, its key containing
+// the pattern if there is one.
+func (b *Bot) randomCalc(req request, data string) (string, error) {
+	pattern := strings.TrimSpace(spaces.ReplaceAllString(data, " "))
+	if pattern != "" && utf8.RuneCountInString(pattern) < minRandomPattern {
+		return fmt.Sprintf("the pattern needs at least %d characters", minRandomPattern), nil
+	}
+	c, ok, err := b.pickCalc(req.channel, pattern, pickRandom, req.when)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		if pattern == "" {
+			return "there are no calcs yet", nil
+		}
+		return fmt.Sprintf("no calcs match %q", pattern), nil
+	}
+	// random picks are not lookups of the key
+	reply, _, _, err := b.showCalc(req, c.Key+"["+lastIndex+"]")
+	return reply, err
+}
+
+// postCalcsOfTheDay posts a random calc to the channels once a day, at the
+// configured time or as soon as the bot is connected after it.
+func (b *Bot) postCalcsOfTheDay() {
+	now := time.Now()
+	day, due := b.dailyDue(now)
+	if !due || !day.After(b.dailyDone) || b.currentSession() == nil {
+		return
+	}
+	ctx := context.Background()
+	done := true
+	for _, channel := range b.conf.Channels {
+		posted, err := b.repo.CountCalcPicks(ctx, repository.CountCalcPicksParams{
+			Channel: channel,
+			Kind:    pickDaily,
+			When:    day,
+		})
+		if err == nil && posted == 0 {
+			err = b.postCalcOfTheDay(channel, now)
+		}
+		if err != nil {
+			log.Error(err, log.String("channel", channel))
+			done = false
+		}
+	}
+	if !done {
+		return
+	}
+	b.dailyDone = day
+}
+
+// cleanupPicks forgets the picks which no longer keep the calcs from being
+// picked again.
+func (b *Bot) cleanupPicks() {
+	before := time.Now().UTC().Add(-b.conf.RandomWindow)
+	if _, err := b.repo.DeleteCalcPicks(context.Background(), before); err != nil {
+		log.Error(err, log.String("nick", b.conf.Nickname))
+	}
+}
+
+func (b *Bot) postCalcOfTheDay(channel string, now time.Time) error {
+	c, ok, err := b.pickCalc(channel, "", pickDaily, now)
+	if err != nil || !ok {
+		return err
+	}
+	req := request{nick: b.conf.Nickname, channel: channel, when: now}
+	calc, _, _, err := b.showCalc(req, c.Key+"["+lastIndex+"]")
+	if err != nil {
+		return err
+	}
+	return b.msg(channel, nil, "calc of the day: "+calc)
+}
@@ -0,0 +1,39 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDailyDue(t *testing.T) {
+	b := newCommandsBot(t)
+	assert.Equal(t, defaultRandomWindow, b.conf.RandomWindow)
+	_, due := b.dailyDue(time.Now())
+	assert.False(t, due)
+
+	b.conf.CalcOfTheDay = "09:30"
+	require.NoError(t, b.initDaily())
+
+	day := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	start, due := b.dailyDue(day.Add(9*time.Hour + 29*time.Minute))
+	assert.False(t, due)
+	assert.Equal(t, day, start)
+
+	start, due = b.dailyDue(day.Add(23 * time.Hour).In(time.FixedZone("MSK", 3*3600)))
+	assert.True(t, due)
+	assert.Equal(t, day, start)
+
+	b.conf.CalcOfTheDay = "25:00"
+	assert.Error(t, b.initDaily())
+}
+
+func TestRandomShortPattern(t *testing.T) {
+	b := newCommandsBot(t)
+	// rejected before the database is queried
+	reply, err := b.handle(request{nick: "user", channel: "#test"}, "!calc-random ab")
+	require.NoError(t, err)
+	assert.Equal(t, "the pattern needs at least 3 characters", reply)
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+// Calc content may embed the latest version of other calcs with {{key}}.
+// References are resolved level by level with one query per level, up to
+// maxRefsDepth levels. Unresolved references are replaced with markers:
+//
+//	{{missing:key}} there is no such key
+//	{{loop:key}}    the key references itself, directly or not
+//	{{depth:key}}   the key is nested too deep
+const maxRefsDepth = 5
+
+var reference = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+
+// snippets hold the content by the normalized key.
+type snippets struct {
+	content map[string]string
+	// keys looked up in the database, found or not
+	fetched map[string]bool
+	norm    func(key string) string
+}
+
+// expandRefs replaces references in the content of the key.
+func (b *Bot) expandRefs(channel, key, content string) (string, error) {
+	if strings.HasPrefix(content, rawMark) || !reference.MatchString(content) {
+		return content, nil
+	}
+	s, err := b.fetchRefs(channel, content)
+	if err != nil {
+		return "", err
+	}
+	limit := expandLimit
+	if n := utf8.RuneCountInString(content); n > limit {
+		limit = n
+	}
+	return truncate(renderRefs(content, s, []string{b.normKey(key)}, limit), limit), nil
+}
+
+func (b *Bot) fetchRefs(channel, content string) (snippets, error) {
+	s := snippets{
+		content: map[string]string{},
+		fetched: map[string]bool{},
+		norm:    b.normKey,
+	}
+	pending := refKeys(content, s.norm, s.fetched)
+	for depth := 0; depth < maxRefsDepth && len(pending) > 0; depth++ {
+		calcs, err := b.getLatestCalcs(channel, pending)
+		if err != nil {
+			return s, err
+		}
+		for _, key := range pending {
+			s.fetched[key] = true
+		}
+		var next []string
+		for _, c := range calcs {
+			content := c.Content
+			if target, ok := aliasTarget(content); ok {
+				content = "{{" + target + "}}"
+			} else {
+				content = calcText(content)
+			}
+			s.content[c.NormKey] = content
+			for _, key := range refKeys(content, s.norm, s.fetched) {
+				if !contains(next, key) {
+					next = append(next, key)
+				}
+			}
+		}
+		pending = next
+	}
+	return s, nil
+}
+
+// getLatestCalcs returns the latest versions of the normalized keys in the
+// channel namespace, looking up the missing ones in the global namespace.
+func (b *Bot) getLatestCalcs(channel string, keys []string) ([]repository.IrcCalc, error) {
+	calcs, err := b.repo.GetLatestCalcs(context.Background(), repository.GetLatestCalcsParams{
+		Channel:  channel,
+		NormKeys: keys,
+	})
+	global := b.fallbackChannel(channel)
+	if err != nil || len(calcs) == len(keys) || global == "" {
+		return calcs, err
+	}
+	fallback, err := b.repo.GetLatestCalcs(context.Background(), repository.GetLatestCalcsParams{
+		Channel:  global,
+		NormKeys: missingKeys(keys, calcs),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(calcs, fallback...), nil
+}
+
+// missingKeys returns the normalized keys none of the calcs has.
+func missingKeys(keys []string, calcs []repository.IrcCalc) []string {
+	var missing []string
+	for _, key := range keys {
+		found := false
+		for _, c := range calcs {
+			found = found || c.NormKey == key
+		}
+		if !found {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// refKeys returns the normalized keys referenced by the content, except the
+// skipped ones.
+func refKeys(content string, norm func(key string) string, skip map[string]bool) []string {
+	var keys []string
+	for _, match := range reference.FindAllStringSubmatch(content, -1) {
+		key := norm(refKey(match[1]))
+		if !skip[key] && !contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func refKey(s string) string {
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+// renderRefs substitutes the references recursively. The stack holds the
+// keys being rendered, to detect loops. Rendering stops once the result is
+// longer than limit characters.
+func renderRefs(content string, s snippets, stack []string, limit int) string {
+	var sb strings.Builder
+	var render func(content string, stack []string)
+	render = func(content string, stack []string) {
+		last := 0
+		for _, loc := range reference.FindAllStringSubmatchIndex(content, -1) {
+			if sb.Len() > limit*utf8.UTFMax {
+				return
+			}
+			sb.WriteString(content[last:loc[0]])
+			last = loc[1]
+			key := refKey(content[loc[2]:loc[3]])
+			norm := s.norm(key)
+			snippet, ok := s.content[norm]
+			switch {
+			case contains(stack, norm):
+				fmt.Fprintf(&sb, "{{loop:%s}}", key)
+			case !s.fetched[norm]:
+				fmt.Fprintf(&sb, "{{depth:%s}}", key)
+			case !ok:
+				fmt.Fprintf(&sb, "{{missing:%s}}", key)
+			default:
+				render(snippet, append(stack[:len(stack):len(stack)], norm))
+			}
+		}
+		sb.WriteString(content[last:])
+	}
+	render(content, stack)
+	return sb.String()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
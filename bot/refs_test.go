@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestRefKeys(t *testing.T) {
+	keys := refKeys("{{a}} and {{ B  c }}, {{A}} {{skip}} {{}}", strings.ToLower, map[string]bool{"skip": true})
+	assert.Equal(t, []string{"a", "b c"}, keys)
+}
+
+func TestRenderRefs(t *testing.T) {
+	s := snippets{
+		content: map[string]string{
+			"server": "irc.example.org:{{port}}",
+			"port":   "6667",
+			"self":   "see {{self}}",
+			"a":      "{{b}}",
+			"b":      "{{a}}",
+		},
+		fetched: map[string]bool{
+			"server": true, "port": true, "self": true, "a": true, "b": true, "missing": true,
+		},
+		norm: strings.ToLower,
+	}
+
+	assert.Equal(t, "connect to irc.example.org:6667",
+		renderRefs("connect to {{server}}", s, []string{"root"}, 100))
+	assert.Equal(t, "{{missing:missing}} {{depth:deep}}",
+		renderRefs("{{missing}} {{deep}}", s, []string{"root"}, 100))
+	assert.Equal(t, "see {{loop:self}}",
+		renderRefs("{{self}}", s, []string{"root"}, 100))
+	assert.Equal(t, "{{loop:a}}",
+		renderRefs("{{a}}", s, []string{"root"}, 100))
+	assert.Equal(t, "{{loop:root}}",
+		renderRefs("{{root}}", s, []string{"root"}, 100))
+	assert.Equal(t, "6667 6667",
+		renderRefs("{{port}} {{PORT}}", s, []string{"root"}, 100))
+	assert.Equal(t, "{{loop:Root}}",
+		renderRefs("{{Root}}", s, []string{"root"}, 100))
+}
+
+func TestMissingKeys(t *testing.T) {
+	calcs := []repository.IrcCalc{{NormKey: "a"}, {NormKey: "c"}}
+	assert.Equal(t, []string{"b", "d"}, missingKeys([]string{"a", "b", "c", "d"}, calcs))
+	assert.Empty(t, missingKeys([]string{"a", "c"}, calcs))
+}
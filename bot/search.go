@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	searchLimit     = 10
+	suggestionLimit = 3
+	// levenshtein() of fuzzystrmatch accepts strings up to 255 characters
+	maxPatternLen = 100
+)
+
+// searchCalcs lists the keys of the channel closest to the pattern.
+func (b *Bot) searchCalcs(req request, data string) (string, error) {
+	pattern, _ := splitIndex(data)
+	keys, err := b.searchKeys(req.channel, pattern, searchLimit)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return fmt.Sprintf("nothing similar to %q", pattern), nil
+	}
+	return fmt.Sprintf("closest to %q: %s", pattern, strings.Join(keys, ", ")), nil
+}
+
+// missingCalc is the reply for an unknown key, with a few suggestions when
+// similar keys exist.
+func (b *Bot) missingCalc(channel, key string) string {
+	reply := fmt.Sprintf("there is no calcs with %q", key)
+	keys, err := b.searchKeys(channel, key, suggestionLimit)
+	if err != nil {
+		log.Error(err)
+		return reply
+	}
+	return suggest(reply, keys)
+}
+
+// suggest adds the similar keys, if any, to the reply for an unknown key.
+func suggest(reply string, keys []string) string {
+	if len(keys) == 0 {
+		return reply
+	}
+	return fmt.Sprintf("%s, did you mean %s?", reply, strings.Join(keys, ", "))
+}
+
+func (b *Bot) searchKeys(channel, pattern string, limit int32) ([]string, error) {
+	if runes := []rune(pattern); len(runes) > maxPatternLen {
+		pattern = string(runes[:maxPatternLen])
+	}
+	rows, err := b.repo.SearchKeys(context.Background(), repository.SearchKeysParams{
+		Pattern: pattern,
+		Channel: channel,
+		Lim:     limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		keys = append(keys, row.Key)
+	}
+	return keys, nil
+}
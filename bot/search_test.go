@@ -0,0 +1,21 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggest(t *testing.T) {
+	reply := `there is no calcs with "fo"`
+	assert.Equal(t, reply, suggest(reply, nil))
+	assert.Equal(t, `there is no calcs with "fo", did you mean foo?`, suggest(reply, []string{"foo"}))
+	assert.Equal(t, `there is no calcs with "fo", did you mean foo, Fox, fob?`,
+		suggest(reply, []string{"foo", "Fox", "fob"}))
+}
+
+func TestMissingCalcWithoutDatabase(t *testing.T) {
+	// the suggestions are optional, the reply does not fail without them
+	b := newCommandsBot(t)
+	assert.Equal(t, `there is no calcs with "fo"`, b.missingCalc("#test", "fo"))
+}
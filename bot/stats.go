@@ -0,0 +1,135 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+const (
+	lookupsFlushInterval = 5 * time.Second
+	// lookups recorded while the database is slow or down are dropped
+	// beyond this
+	maxPendingLookups = 10000
+	// the sizes of the key columns of irc_calc_lookups, a longer key would
+	// fail the whole batch
+	lookupKeyLen     = 100
+	lookupNormKeyLen = 200
+
+	statsWindow = 30 * 24 * time.Hour
+	statsLimit  = 5
+)
+
+// lookups buffers the lookups and writes of calcs until the stats worker
+// writes them in a batch, the replies do not wait for the database.
+type lookups struct {
+	mu      sync.Mutex
+	pending []repository.IrcCalcLookup
+	dropped int64
+}
+
+func newLookups() *lookups {
+	return &lookups{}
+}
+
+// add buffers the lookup, it is dropped if the buffer is full.
+func (l *lookups) add(lookup repository.IrcCalcLookup) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) >= maxPendingLookups {
+		l.dropped++
+		return
+	}
+	l.pending = append(l.pending, lookup)
+}
+
+// take returns the buffered lookups and the number of the dropped ones since
+// the last call.
+func (l *lookups) take() ([]repository.IrcCalcLookup, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending, dropped := l.pending, l.dropped
+	l.pending, l.dropped = nil, 0
+	return pending, dropped
+}
+
+// recordLookup records the lookup or the write of the key by the request.
+func (b *Bot) recordLookup(req request, key string, hit, write bool) {
+	b.lookups.add(repository.IrcCalcLookup{
+		Channel: req.channel,
+		Key:     cutRunes(key, lookupKeyLen),
+		NormKey: cutRunes(b.normKey(key), lookupNormKeyLen),
+		Nick:    req.nick,
+		Hit:     hit,
+		Write:   write,
+		When:    req.when.UTC(),
+	})
+}
+
+// cutRunes returns at most n first runes of s.
+func cutRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
+
+// flushLookups writes the buffered lookups.
+func (b *Bot) flushLookups() {
+	pending, dropped := b.lookups.take()
+	if dropped > 0 {
+		log.Info("lookups dropped", log.String("nick", b.conf.Nickname), log.Int64("dropped", dropped))
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if err := b.repo.AddLookups(context.Background(), pending); err != nil {
+		log.Error(err, log.String("nick", b.conf.Nickname), log.Int("lookups", len(pending)))
+	}
+}
+
+// statsCommand shows the usage statistics of the channel.
+func (b *Bot) statsCommand(req request, data string) (string, error) {
+	stats, err := b.repo.GetStats(context.Background(), req.channel, req.when.UTC().Add(-statsWindow), statsLimit)
+	if err != nil {
+		return "", err
+	}
+	return FormatStats(req.channel, stats, " | "), nil
+}
+
+// FormatStats formats the statistics of the channel, its sections joined by
+// the separator.
+func FormatStats(channel string, stats repository.Stats, sep string) string {
+	keys := make([]string, 0, len(stats.TopKeys))
+	for _, k := range stats.TopKeys {
+		keys = append(keys, fmt.Sprintf("%s (%d)", k.Key, k.Lookups))
+	}
+	contributors := make([]string, 0, len(stats.Contributors))
+	for _, c := range stats.Contributors {
+		contributors = append(contributors, fmt.Sprintf("%s (%d)", c.By, c.Versions))
+	}
+	misses := make([]string, 0, len(stats.Misses))
+	for _, m := range stats.Misses {
+		misses = append(misses, fmt.Sprintf("%s (%d nicks, %d lookups)", m.Key, m.Nicks, m.Lookups))
+	}
+	return strings.Join([]string{
+		fmt.Sprintf("%s: %d keys", channel, stats.Keys),
+		"top keys: " + listOrNone(keys),
+		"top contributors: " + listOrNone(contributors),
+		"missing: " + listOrNone(misses),
+	}, sep)
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
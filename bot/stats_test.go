@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+func TestLookups(t *testing.T) {
+	l := newLookups()
+	for i := 0; i < maxPendingLookups+2; i++ {
+		l.add(repository.IrcCalcLookup{Key: "key"})
+	}
+	pending, dropped := l.take()
+	assert.Len(t, pending, maxPendingLookups)
+	assert.Equal(t, int64(2), dropped)
+
+	pending, dropped = l.take()
+	assert.Empty(t, pending)
+	assert.Zero(t, dropped)
+}
+
+func TestRecordLookup(t *testing.T) {
+	b := newCommandsBot(t)
+	b.recordLookup(request{nick: "user", channel: "#chan"}, "Foo  Bar", false, false)
+	pending, _ := b.lookups.take()
+	require.Len(t, pending, 1)
+	assert.Equal(t, "#chan", pending[0].Channel)
+	assert.Equal(t, "foo bar", pending[0].NormKey)
+	assert.False(t, pending[0].Hit)
+
+	// the lookups of very long keys still fit the columns
+	long := strings.Repeat("Ж", lookupNormKeyLen+1)
+	b.recordLookup(request{nick: "user", channel: "#chan"}, long, false, false)
+	pending, _ = b.lookups.take()
+	require.Len(t, pending, 1)
+	assert.Equal(t, strings.Repeat("Ж", lookupKeyLen), pending[0].Key)
+	assert.Equal(t, strings.Repeat("ж", lookupNormKeyLen), pending[0].NormKey)
+}
+
+func TestFormatStats(t *testing.T) {
+	stats := repository.Stats{
+		Keys:         42,
+		TopKeys:      []repository.GetTopKeysRow{{Key: "foo", Lookups: 7}, {Key: "bar", Lookups: 3}},
+		Contributors: []repository.GetTopContributorsRow{{By: "nick", Versions: 12}},
+	}
+	assert.Equal(t, "#chan: 42 keys | top keys: foo (7), bar (3) | top contributors: nick (12) | missing: none",
+		FormatStats("#chan", stats, " | "))
+}
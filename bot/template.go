@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Calc content is expanded at lookup time. The supported variables are:
+//
+//	$nick        nick of the user asking for the calc
+//	$channel     the channel
+//	$date        date of the request, UTC, 2006-01-02
+//	$time        time of the request, UTC, 15:04:05
+//	$args        words following the key, "!calc greet John Smith"
+//	$random_nick random nick present in the channel
+//	$$           a literal "$"
+//
+// Unknown variables are left as is. Content starting with rawMark is not
+// expanded at all, the mark itself is stripped.
+const (
+	rawMark = "$raw "
+
+	// expansion never makes content longer than that, unless the content
+	// itself is longer
+	expandLimit = 400
+	argsLimit   = 100
+)
+
+type templateVars struct {
+	Nick       string
+	Channel    string
+	When       time.Time
+	Args       string
+	RandomNick func() string
+}
+
+func (v templateVars) lookup(name string) (string, bool) {
+	switch name {
+	case "nick":
+		return v.Nick, true
+	case "channel":
+		return v.Channel, true
+	case "date":
+		return v.When.UTC().Format("2006-01-02"), true
+	case "time":
+		return v.When.UTC().Format("15:04:05"), true
+	case "args":
+		return truncate(v.Args, argsLimit), true
+	case "random_nick":
+		if v.RandomNick == nil {
+			return "", true
+		}
+		return v.RandomNick(), true
+	}
+	return "", false
+}
+
+// expandTemplate substitutes the variables in the content.
+func expandTemplate(content string, vars templateVars) string {
+	if strings.HasPrefix(content, rawMark) {
+		return content[len(rawMark):]
+	}
+	if !strings.Contains(content, "$") {
+		return content
+	}
+	var sb strings.Builder
+	for i := 0; i < len(content); {
+		if content[i] != '$' {
+			sb.WriteByte(content[i])
+			i++
+			continue
+		}
+		if i+1 < len(content) && content[i+1] == '$' {
+			sb.WriteByte('$')
+			i += 2
+			continue
+		}
+		j := i + 1
+		for j < len(content) && isVarChar(content[j]) {
+			j++
+		}
+		value, ok := vars.lookup(content[i+1 : j])
+		if !ok {
+			sb.WriteString(content[i:j])
+		} else {
+			sb.WriteString(value)
+		}
+		i = j
+	}
+	limit := expandLimit
+	if n := utf8.RuneCountInString(content); n > limit {
+		limit = n
+	}
+	return truncate(sb.String(), limit)
+}
+
+// usesArgs reports whether the expanded content depends on $args.
+func usesArgs(content string) bool {
+	return !strings.HasPrefix(content, rawMark) && strings.Contains(content, "$args")
+}
+
+func isVarChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c == '_'
+}
@@ -0,0 +1,30 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	vars := templateVars{
+		Nick:       "john",
+		Channel:    "#chan",
+		When:       time.Date(2021, 12, 31, 23, 59, 58, 0, time.UTC),
+		Args:       "foo bar",
+		RandomNick: func() string { return "mary" },
+	}
+
+	assert.Equal(t,
+		"hi john, welcome to #chan, it's 2021-12-31 23:59:58",
+		expandTemplate("hi $nick, welcome to $channel, it's $date $time", vars))
+	assert.Equal(t, "mary says foo bar", expandTemplate("$random_nick says $args", vars))
+	assert.Equal(t, "costs $5, $unknown", expandTemplate("costs $$5, $unknown", vars))
+	assert.Equal(t, "$nick", expandTemplate("$raw $nick", vars))
+	assert.Equal(t, "trailing $", expandTemplate("trailing $", vars))
+
+	vars.Args = strings.Repeat("x", 1000)
+	assert.Equal(t, expandLimit, len(expandTemplate(strings.Repeat("$args", 10), vars)))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adzip-kadum/irc-calc/bot"
+	"github.com/adzip-kadum/irc-calc/log"
+	"github.com/adzip-kadum/irc-calc/postgres"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+var normalizeBatch *int32
+
+func init() {
+	normalizeBatch = normalizeCmd.Flags().Int32P("batch", "b", 1000, "Rows updated per transaction")
+	rootCmd.AddCommand(normalizeCmd)
+}
+
+var normalizeCmd = &cobra.Command{
+	Use:   "normalize-keys",
+	Short: "Recompute the normalized keys of the calcs",
+	RunE: func(*cobra.Command, []string) error {
+		pool, err := postgres.NewPgxPool(Config.Postgres)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		repo := repository.NewCalcsRepository(pool)
+		updated, err := repo.NormalizeKeys(context.Background(), bot.KeyNormalizer(Config.Bots), *normalizeBatch)
+		if err != nil {
+			return err
+		}
+		log.Info("keys normalized", log.Int64("updated", updated))
+		return nil
+	},
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/adzip-kadum/irc-calc/bot"
+	"github.com/adzip-kadum/irc-calc/postgres"
+	"github.com/adzip-kadum/irc-calc/repository"
+)
+
+var (
+	statsChannel *string
+	statsDays    *int
+	statsLimit   *int32
+)
+
+func init() {
+	statsChannel = statsCmd.Flags().StringP("channel", "c", "", "Channel to report on, all the configured ones if empty")
+	statsDays = statsCmd.Flags().IntP("days", "d", 30, "Days of lookups counted")
+	statsLimit = statsCmd.Flags().Int32P("limit", "l", 10, "Entries of each list")
+	rootCmd.AddCommand(statsCmd)
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Report the keys, the top lookups, contributors and misses of the channels",
+	RunE: func(*cobra.Command, []string) error {
+		channels := []string{*statsChannel}
+		if *statsChannel == "" {
+			channels = nil
+			for _, conf := range Config.Bots {
+				if conf.Channel != "" {
+					channels = append(channels, conf.Channel)
+				}
+				channels = append(channels, conf.Channels...)
+			}
+		}
+
+		pool, err := postgres.NewPgxPool(Config.Postgres)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+
+		repo := repository.NewCalcsRepository(pool)
+		since := time.Now().UTC().AddDate(0, 0, -*statsDays)
+		for _, channel := range channels {
+			stats, err := repo.GetStats(context.Background(), channel, since, *statsLimit)
+			if err != nil {
+				return err
+			}
+			fmt.Println(bot.FormatStats(channel, stats, "\n  "))
+		}
+		return nil
+	},
+}
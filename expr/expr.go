@@ -0,0 +1,99 @@
+// Package expr evaluates arithmetic expressions for the calculator mode of the
+// bot. Arithmetic is done with arbitrary precision, functions are computed
+// with float64 precision. Input size, nesting depth, exponents and the
+// magnitude of every value are bounded and evaluation stops once the context
+// is done, so an expression can not hang the caller.
+//
+// Supported syntax:
+//
+//	2 + 2 * 3, (1 - 2) / 3, 7 % 3, 2 ^ 100, 2 ** 100, -x
+//	0xff, 0b1010, 0o17, 1.5e-3
+//	pi, e
+//	sqrt cbrt abs ln log log2 exp sin cos tan asin acos atan floor ceil round
+//	255 to hex, 0xff to dec, 10 to bin, 8 to oct
+//	10 km to mi, 100 °C to °F, 1 KiB in MB
+package expr
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Precision of arithmetic in bits
+	Precision = 256
+
+	maxInput    = 256
+	maxDepth    = 64
+	maxExponent = 1 << 20
+	// values are within ±2^maxBits, larger ones take too long to format
+	maxBits = 1 << 16
+	// significant digits of non-integer results
+	digits = 20
+)
+
+// Eval evaluates the expression and formats the result. Conversions to
+// another unit or base are written as "<expr> to <unit>" or "<expr> in
+// <unit>".
+func Eval(ctx context.Context, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return "", errors.New("empty expression")
+	}
+	if len(input) > maxInput {
+		return "", errors.Errorf("expression is longer than %d bytes", maxInput)
+	}
+	if left, target, ok := splitConversion(input); ok {
+		return convert(ctx, left, target)
+	}
+	v, err := evaluate(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return format(v), nil
+}
+
+func evaluate(ctx context.Context, input string) (*big.Float, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{ctx: ctx, tokens: tokens}
+	v, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errors.Errorf("unexpected %q", t.text)
+	}
+	return v, nil
+}
+
+func format(v *big.Float) string {
+	// larger integers are not exact
+	if v.IsInt() && v.MantExp(nil) <= Precision {
+		i, _ := v.Int(nil)
+		return i.String()
+	}
+	return v.Text('g', digits)
+}
+
+// bounded returns the value if it is finite and its magnitude is within
+// 2^±maxBits. Infinities make big.Float panic on NaN results and huge
+// exponents make the conversions to integers and text slow.
+func bounded(v *big.Float) (*big.Float, error) {
+	if v.IsInf() {
+		return nil, errors.New("result is not a finite number")
+	}
+	if exp := v.MantExp(nil); exp > maxBits || exp < -maxBits {
+		return nil, errors.Errorf("result is out of range 2^±%d", maxBits)
+	}
+	return v, nil
+}
+
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(Precision)
+}
@@ -0,0 +1,90 @@
+package expr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEval(t *testing.T) {
+	for input, expected := range map[string]string{
+		"2+2*3":              "8",
+		"(2+2)*3":            "12",
+		"-2^2":               "-4",
+		"2^-1":               "0.5",
+		"2**3**2":            "512",
+		"7 % 3":              "1",
+		"0.1 + 0.2":          "0.3",
+		"1/3":                "0.33333333333333333333",
+		"2^200":              "1606938044258990275541962092341162602522202993782792835301376",
+		"0xff + 0b11 + 0o10": "266",
+		"1.5e3":              "1500",
+		"sqrt(16)":           "4",
+		"floor(-1.5)":        "-2",
+		"ceil(1.2)":          "2",
+		"round(2.5)":         "3",
+		"log(1000)":          "3",
+		"cos(0)":             "1",
+		"255 to hex":         "0xff",
+		"0xff to dec":        "255",
+		"10 to bin":          "0b1010",
+		"-8 to oct":          "-0o10",
+		"10 km to mi":        "6.2137119223733396962 mi",
+		"100 °C to °F":       "212 °F",
+		"32 F in C":          "0 °C",
+		"1 KiB in B":         "1024 B",
+		"1 in in cm":         "2.54 cm",
+		"36 km/h to m/s":     "10 m/s",
+	} {
+		result, err := Eval(context.Background(), input)
+		if assert.NoError(t, err, input) {
+			assert.Equal(t, expected, result, input)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"1/0",
+		"1 % 0",
+		"sqrt(-1)",
+		"2 +",
+		"(1",
+		"foo",
+		"nginx",
+		"2^10000000",
+		"1.5 to hex",
+		"10 km to kg",
+		"10 parsec to m",
+		strings.Repeat("(", 100) + "1" + strings.Repeat(")", 100),
+		strings.Repeat("1+", 200) + "1",
+		"floor(1e999999999)",
+		"ceil(1e999999999)",
+		"round(1e999999999)",
+		"1e999999999 % 7",
+		"1 % 1e-400",
+		"1e300000000 to bin",
+		"1e300000000 to dec",
+		"round(1e300000000)",
+		"2^1048576 to dec",
+		"2^65537",
+		"0.5^65538",
+		"(2^65000)^(2^20)",
+	} {
+		_, err := Eval(context.Background(), input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestEvalTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	_, err := Eval(ctx, "2^1000")
+	require.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package expr
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value *big.Float
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case isDigit(c) || c == '.':
+			j, v, err := lexNumber(input, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: input[i:j], value: v})
+			i = j
+		case isLetter(c):
+			j := i
+			for j < len(input) && (isLetter(input[j]) || isDigit(input[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: strings.ToLower(input[i:j])})
+			i = j
+		case c == '*' && i+1 < len(input) && input[i+1] == '*':
+			tokens = append(tokens, token{kind: tokOp, text: "^"})
+			i += 2
+		case strings.IndexByte("+-*/%^", c) >= 0:
+			tokens = append(tokens, token{kind: tokOp, text: input[i : i+1]})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")"})
+			i++
+		default:
+			return nil, errors.Errorf("unexpected character %q", input[i:i+1])
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "end of expression"}), nil
+}
+
+func lexNumber(input string, i int) (int, *big.Float, error) {
+	if input[i] == '0' && i+1 < len(input) {
+		base := 0
+		switch input[i+1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+		if base != 0 {
+			j := i + 2
+			for j < len(input) && (isDigit(input[j]) || isLetter(input[j])) {
+				j++
+			}
+			n, ok := new(big.Int).SetString(input[i+2:j], base)
+			if !ok {
+				return 0, nil, errors.Errorf("invalid number %q", input[i:j])
+			}
+			return j, newFloat().SetInt(n), nil
+		}
+	}
+	j := i
+	for j < len(input) && (isDigit(input[j]) || input[j] == '.') {
+		j++
+	}
+	if j < len(input) && (input[j] == 'e' || input[j] == 'E') {
+		k := j + 1
+		if k < len(input) && (input[k] == '+' || input[k] == '-') {
+			k++
+		}
+		if k < len(input) && isDigit(input[k]) {
+			for k < len(input) && isDigit(input[k]) {
+				k++
+			}
+			j = k
+		}
+	}
+	v, _, err := newFloat().Parse(input[i:j], 10)
+	if err != nil {
+		return 0, nil, errors.Errorf("invalid number %q", input[i:j])
+	}
+	if v, err = bounded(v); err != nil {
+		return 0, nil, errors.Errorf("number %q is out of range 2^±%d", input[i:j], maxBits)
+	}
+	return j, v, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,324 @@
+package expr
+
+import (
+	"context"
+	"math"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// parser evaluates the expression while parsing it:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = primary [ "^" unary ]
+//	primary = number | constant | function "(" expr ")" | "(" expr ")"
+type parser struct {
+	ctx    context.Context
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return errors.Errorf("expression is nested deeper than %d", maxDepth)
+	}
+	return p.ctx.Err()
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) expr() (*big.Float, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	v, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "+" && t.text != "-") {
+			return v, nil
+		}
+		p.next()
+		r, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			v = newFloat().Add(v, r)
+		} else {
+			v = newFloat().Sub(v, r)
+		}
+		if v, err = bounded(v); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) term() (*big.Float, error) {
+	v, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		if t.kind != tokOp || (t.text != "*" && t.text != "/" && t.text != "%") {
+			return v, nil
+		}
+		p.next()
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "*":
+			v = newFloat().Mul(v, r)
+		case "/":
+			if r.Sign() == 0 {
+				return nil, errors.New("division by zero")
+			}
+			v = newFloat().Quo(v, r)
+		case "%":
+			if v, err = mod(v, r); err != nil {
+				return nil, err
+			}
+		}
+		if v, err = bounded(v); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) unary() (*big.Float, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	t := p.peek()
+	if t.kind == tokOp && (t.text == "-" || t.text == "+") {
+		p.next()
+		v, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "-" {
+			v = newFloat().Neg(v)
+		}
+		return v, nil
+	}
+	return p.power()
+}
+
+func (p *parser) power() (*big.Float, error) {
+	v, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokOp || t.text != "^" {
+		return v, nil
+	}
+	p.next()
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return pow(p.ctx, v, exp)
+}
+
+func (p *parser) primary() (*big.Float, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return t.value, nil
+	case tokLParen:
+		v, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, errors.Errorf("expected \")\", got %q", t.text)
+		}
+		return v, nil
+	case tokIdent:
+		if c, ok := constants[t.text]; ok {
+			v, _, err := newFloat().Parse(c, 10)
+			return v, err
+		}
+		f, ok := functions[t.text]
+		if !ok {
+			return nil, errors.Errorf("unknown name %q", t.text)
+		}
+		if t := p.next(); t.kind != tokLParen {
+			return nil, errors.Errorf("expected \"(\" after %s", t.text)
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, errors.Errorf("expected \")\", got %q", t.text)
+		}
+		v, err := f(arg)
+		if err != nil {
+			return nil, err
+		}
+		return bounded(v)
+	}
+	return nil, errors.Errorf("unexpected %q", t.text)
+}
+
+var constants = map[string]string{
+	"pi": "3.14159265358979323846264338327950288419716939937510582097494459230781640628620899",
+	"e":  "2.71828182845904523536028747135266249775724709369995957496696762772407663035354759",
+}
+
+var functions = map[string]func(*big.Float) (*big.Float, error){
+	"sqrt": func(x *big.Float) (*big.Float, error) {
+		if x.Sign() < 0 {
+			return nil, errors.New("sqrt of negative number")
+		}
+		return newFloat().Sqrt(x), nil
+	},
+	"abs":   func(x *big.Float) (*big.Float, error) { return newFloat().Abs(x), nil },
+	"floor": func(x *big.Float) (*big.Float, error) { return round(x, big.ToNegativeInf), nil },
+	"ceil":  func(x *big.Float) (*big.Float, error) { return round(x, big.ToPositiveInf), nil },
+	"round": func(x *big.Float) (*big.Float, error) { return round(x, big.ToNearestAway), nil },
+	"cbrt":  float64Func(math.Cbrt),
+	"ln":    float64Func(math.Log),
+	"log":   float64Func(math.Log10),
+	"log2":  float64Func(math.Log2),
+	"exp":   float64Func(math.Exp),
+	"sin":   float64Func(math.Sin),
+	"cos":   float64Func(math.Cos),
+	"tan":   float64Func(math.Tan),
+	"asin":  float64Func(math.Asin),
+	"acos":  float64Func(math.Acos),
+	"atan":  float64Func(math.Atan),
+}
+
+func float64Func(f func(float64) float64) func(*big.Float) (*big.Float, error) {
+	return func(x *big.Float) (*big.Float, error) {
+		fx, _ := x.Float64()
+		r := f(fx)
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return nil, errors.New("result is not a finite number")
+		}
+		return newFloat().SetFloat64(r), nil
+	}
+}
+
+// round rounds x to an integer in the given mode.
+func round(x *big.Float, mode big.RoundingMode) *big.Float {
+	if x.IsInt() {
+		return x
+	}
+	// integer part, truncated towards zero
+	i, _ := x.Int(nil)
+	t := newFloat().SetInt(i)
+	frac := newFloat().Sub(x, t)
+	switch mode {
+	case big.ToNegativeInf:
+		if frac.Sign() < 0 {
+			t.Sub(t, big.NewFloat(1))
+		}
+	case big.ToPositiveInf:
+		if frac.Sign() > 0 {
+			t.Add(t, big.NewFloat(1))
+		}
+	default:
+		half := big.NewFloat(0.5)
+		if frac.Sign() > 0 && frac.Cmp(half) >= 0 {
+			t.Add(t, big.NewFloat(1))
+		} else if frac.Sign() < 0 && newFloat().Neg(frac).Cmp(half) >= 0 {
+			t.Sub(t, big.NewFloat(1))
+		}
+	}
+	return t
+}
+
+func mod(x, y *big.Float) (*big.Float, error) {
+	if y.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+	if x.IsInt() && y.IsInt() {
+		xi, _ := x.Int(nil)
+		yi, _ := y.Int(nil)
+		return newFloat().SetInt(new(big.Int).Rem(xi, yi)), nil
+	}
+	fx, _ := x.Float64()
+	fy, _ := y.Float64()
+	r := math.Mod(fx, fy)
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil, errors.New("result is not a finite number")
+	}
+	return newFloat().SetFloat64(r), nil
+}
+
+// pow raises x to y. Integer exponents are computed exactly by squaring,
+// others with float64 precision.
+func pow(ctx context.Context, x, y *big.Float) (*big.Float, error) {
+	if !y.IsInt() {
+		fx, _ := x.Float64()
+		fy, _ := y.Float64()
+		r := math.Pow(fx, fy)
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return nil, errors.New("result is not a finite number")
+		}
+		return newFloat().SetFloat64(r), nil
+	}
+	n, _ := y.Int64()
+	if n > maxExponent || n < -maxExponent {
+		return nil, errors.Errorf("exponent is out of range ±%d", maxExponent)
+	}
+	neg := n < 0
+	if neg {
+		if x.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		n = -n
+	}
+	// |x| is within [2^(e-1), 2^e), the result is rejected before it is
+	// computed if it is out of range anyway
+	if e := int64(x.MantExp(nil)); x.Sign() != 0 && ((e-1)*n > maxBits || e*n < -maxBits) {
+		return nil, errors.Errorf("result is out of range 2^±%d", maxBits)
+	}
+	result := newFloat().SetInt64(1)
+	base := newFloat().Set(x)
+	for n > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if n&1 == 1 {
+			result.Mul(result, base)
+		}
+		base.Mul(base, base)
+		n >>= 1
+	}
+	if neg {
+		result.Quo(newFloat().SetInt64(1), result)
+	}
+	return bounded(result)
+}
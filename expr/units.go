@@ -0,0 +1,164 @@
+package expr
+
+import (
+	"context"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// unit converts values to the base unit of its kind: base = (v + offset) *
+// scale. Offsets are needed for temperatures only.
+type unit struct {
+	kind   string
+	name   string
+	scale  string
+	offset string
+}
+
+var units = map[string]unit{}
+
+func init() {
+	for _, u := range []struct {
+		unit
+		aliases []string
+	}{
+		{unit{"length", "m", "1", "0"}, []string{"meter", "meters", "metre", "metres"}},
+		{unit{"length", "km", "1000", "0"}, []string{"kilometer", "kilometers"}},
+		{unit{"length", "cm", "1/100", "0"}, nil},
+		{unit{"length", "mm", "1/1000", "0"}, nil},
+		{unit{"length", "mi", "1609.344", "0"}, []string{"mile", "miles"}},
+		{unit{"length", "nmi", "1852", "0"}, nil},
+		{unit{"length", "yd", "0.9144", "0"}, []string{"yard", "yards"}},
+		{unit{"length", "ft", "0.3048", "0"}, []string{"foot", "feet"}},
+		{unit{"length", "in", "0.0254", "0"}, []string{"inch", "inches"}},
+
+		{unit{"mass", "g", "1", "0"}, []string{"gram", "grams"}},
+		{unit{"mass", "kg", "1000", "0"}, []string{"kilogram", "kilograms"}},
+		{unit{"mass", "mg", "1/1000", "0"}, nil},
+		{unit{"mass", "t", "1000000", "0"}, []string{"tonne", "tonnes"}},
+		{unit{"mass", "lb", "453.59237", "0"}, []string{"lbs", "pound", "pounds"}},
+		{unit{"mass", "oz", "28.349523125", "0"}, []string{"ounce", "ounces"}},
+
+		{unit{"temperature", "°C", "1", "273.15"}, []string{"c", "celsius"}},
+		{unit{"temperature", "°F", "5/9", "459.67"}, []string{"f", "fahrenheit"}},
+		{unit{"temperature", "K", "1", "0"}, []string{"k", "kelvin"}},
+
+		{unit{"speed", "m/s", "1", "0"}, nil},
+		{unit{"speed", "km/h", "5/18", "0"}, []string{"kmh", "kph"}},
+		{unit{"speed", "mph", "0.44704", "0"}, nil},
+		{unit{"speed", "kn", "1852/3600", "0"}, []string{"knot", "knots"}},
+
+		{unit{"data", "bit", "1/8", "0"}, []string{"bits"}},
+		{unit{"data", "B", "1", "0"}, []string{"byte", "bytes"}},
+		{unit{"data", "KB", "1000", "0"}, nil},
+		{unit{"data", "MB", "1000000", "0"}, nil},
+		{unit{"data", "GB", "1000000000", "0"}, nil},
+		{unit{"data", "TB", "1000000000000", "0"}, nil},
+		{unit{"data", "KiB", "1024", "0"}, nil},
+		{unit{"data", "MiB", "1048576", "0"}, nil},
+		{unit{"data", "GiB", "1073741824", "0"}, nil},
+		{unit{"data", "TiB", "1099511627776", "0"}, nil},
+	} {
+		units[strings.ToLower(u.name)] = u.unit
+		for _, alias := range u.aliases {
+			units[alias] = u.unit
+		}
+	}
+	units["°c"] = units["c"]
+	units["°f"] = units["f"]
+}
+
+var (
+	conversion = regexp.MustCompile(`^(.+)\s+(?:to|in)\s+(\S+)$`)
+	unitSuffix = regexp.MustCompile(`^(.*?)\s*(°?[A-Za-z][A-Za-z/]*)$`)
+)
+
+func splitConversion(input string) (string, string, bool) {
+	match := conversion.FindStringSubmatch(input)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// convert evaluates the left part and converts it to the target unit or base.
+func convert(ctx context.Context, left, target string) (string, error) {
+	switch strings.ToLower(target) {
+	case "hex":
+		return convertBase(ctx, left, 16, "0x")
+	case "oct":
+		return convertBase(ctx, left, 8, "0o")
+	case "bin":
+		return convertBase(ctx, left, 2, "0b")
+	case "dec":
+		return convertBase(ctx, left, 10, "")
+	}
+	to, ok := units[strings.ToLower(target)]
+	if !ok {
+		return "", errors.Errorf("unknown unit %q", target)
+	}
+	match := unitSuffix.FindStringSubmatch(left)
+	if match == nil {
+		return "", errors.Errorf("no unit to convert from in %q", left)
+	}
+	from, ok := units[strings.ToLower(match[2])]
+	if !ok {
+		return "", errors.Errorf("unknown unit %q", match[2])
+	}
+	if from.kind != to.kind {
+		return "", errors.Errorf("can not convert %s to %s", from.kind, to.kind)
+	}
+	v := newFloat().SetInt64(1)
+	if strings.TrimSpace(match[1]) != "" {
+		var err error
+		if v, err = evaluate(ctx, match[1]); err != nil {
+			return "", err
+		}
+	}
+	base := newFloat().Mul(newFloat().Add(v, from.offsetValue()), from.scaleValue())
+	result, err := bounded(newFloat().Sub(newFloat().Quo(base, to.scaleValue()), to.offsetValue()))
+	if err != nil {
+		return "", err
+	}
+	return format(result) + " " + to.name, nil
+}
+
+func convertBase(ctx context.Context, input string, base int, prefix string) (string, error) {
+	v, err := evaluate(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	if !v.IsInt() {
+		return "", errors.New("only integers can be converted to another base")
+	}
+	// larger integers are not exact
+	if v.MantExp(nil) > Precision {
+		return "", errors.Errorf("only integers below 2^%d can be converted to another base", Precision)
+	}
+	i, _ := v.Int(nil)
+	sign := ""
+	if i.Sign() < 0 {
+		sign = "-"
+		i.Neg(i)
+	}
+	return sign + prefix + i.Text(base), nil
+}
+
+func (u unit) scaleValue() *big.Float {
+	return ratio(u.scale)
+}
+
+func (u unit) offsetValue() *big.Float {
+	return ratio(u.offset)
+}
+
+func ratio(s string) *big.Float {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		panic("invalid unit ratio " + s)
+	}
+	return newFloat().SetRat(r)
+}
@@ -20,3 +20,5 @@ require (
 	golang.org/x/text v0.3.7
 	gopkg.in/inconshreveable/log15.v2 v2.0.0-20200109203555-b30bc20e4fd1
 )
+
+replace github.com/whyrusleeping/hellabot => ./third_party/hellabot
@@ -113,6 +113,7 @@ func Logger() *zap.Logger { return logger }
 var (
 	Int      = zap.Int
 	Int32    = zap.Int32
+	Int64    = zap.Int64
 	Float64  = zap.Float64
 	String   = zap.String
 	Strings  = zap.Strings
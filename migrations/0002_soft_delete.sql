@@ -0,0 +1,26 @@
+ALTER TABLE irc_calcs
+    ADD COLUMN deleted_at TIMESTAMP    NULL,
+    ADD COLUMN deleted_by VARCHAR(255) NULL;
+
+CREATE TABLE irc_calcs_audit
+(
+    id      BIGSERIAL    NOT NULL PRIMARY KEY,
+    calc_id BIGINT       NOT NULL REFERENCES irc_calcs (id),
+    channel VARCHAR(100) NOT NULL,
+    "key"   VARCHAR(100) NOT NULL,
+    action  VARCHAR(16)  NOT NULL,
+    by      VARCHAR(255) NOT NULL,
+    "when"  TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX audit_channel_when_index
+    ON irc_calcs_audit USING BTREE (channel, "when");
+
+---- create above / drop below ----
+
+DROP INDEX audit_channel_when_index;
+DROP TABLE irc_calcs_audit;
+
+ALTER TABLE irc_calcs
+    DROP COLUMN deleted_at,
+    DROP COLUMN deleted_by;
@@ -0,0 +1,8 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX key_trgm_index
+    ON irc_calcs USING GIN ("key" gin_trgm_ops);
+
+---- create above / drop below ----
+
+DROP INDEX key_trgm_index;
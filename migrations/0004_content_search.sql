@@ -0,0 +1,23 @@
+-- The text search configuration is taken from postgres.textSearchConfig,
+-- changing it requires migrating down and up again.
+CREATE FUNCTION irc_calcs_ts_config() RETURNS regconfig
+    LANGUAGE sql IMMUTABLE AS
+$$
+SELECT '{{ default "russian" .textSearchConfig }}'::regconfig
+$$;
+
+ALTER TABLE irc_calcs
+    ADD COLUMN content_tsv TSVECTOR
+        GENERATED ALWAYS AS (to_tsvector(irc_calcs_ts_config(), content)) STORED;
+
+CREATE INDEX content_tsv_index
+    ON irc_calcs USING GIN (content_tsv);
+
+---- create above / drop below ----
+
+DROP INDEX content_tsv_index;
+
+ALTER TABLE irc_calcs
+    DROP COLUMN content_tsv;
+
+DROP FUNCTION irc_calcs_ts_config();
@@ -0,0 +1,10 @@
+CREATE TABLE irc_nick_encodings
+(
+    nick     VARCHAR(255) NOT NULL PRIMARY KEY,
+    encoding VARCHAR(32)  NOT NULL,
+    "when"   TIMESTAMP    NOT NULL
+);
+
+---- create above / drop below ----
+
+DROP TABLE irc_nick_encodings;
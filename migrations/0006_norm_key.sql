@@ -0,0 +1,21 @@
+-- Keys are matched by their normalized form, see repository.NormalizeKey.
+-- The column is filled approximately here, "irc-calc normalize-keys"
+-- recomputes it.
+ALTER TABLE irc_calcs
+    ADD COLUMN norm_key VARCHAR(200);
+
+UPDATE irc_calcs
+SET norm_key = lower(regexp_replace(btrim("key"), '\s+', ' ', 'g'));
+
+ALTER TABLE irc_calcs
+    ALTER COLUMN norm_key SET NOT NULL;
+
+CREATE INDEX channel_norm_key_index
+    ON irc_calcs USING BTREE (channel, norm_key);
+
+---- create above / drop below ----
+
+DROP INDEX channel_norm_key_index;
+
+ALTER TABLE irc_calcs
+    DROP COLUMN norm_key;
@@ -0,0 +1,12 @@
+-- Versions of a key are fetched one at a time by their position in time.
+CREATE INDEX channel_norm_key_when_index
+    ON irc_calcs USING BTREE (channel, norm_key, "when");
+
+DROP INDEX channel_norm_key_index;
+
+---- create above / drop below ----
+
+CREATE INDEX channel_norm_key_index
+    ON irc_calcs USING BTREE (channel, norm_key);
+
+DROP INDEX channel_norm_key_when_index;
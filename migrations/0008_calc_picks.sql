@@ -0,0 +1,21 @@
+-- Random calcs are picked by seeking a random id.
+CREATE INDEX channel_id_index
+    ON irc_calcs USING BTREE (channel, id);
+
+-- Calcs picked at random recently are not picked again.
+CREATE TABLE irc_calc_picks
+(
+    channel  VARCHAR(100) NOT NULL,
+    norm_key VARCHAR(200) NOT NULL,
+    kind     VARCHAR(32)  NOT NULL,
+    "when"   TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX calc_picks_channel_when_index
+    ON irc_calc_picks USING BTREE (channel, "when");
+
+---- create above / drop below ----
+
+DROP TABLE irc_calc_picks;
+
+DROP INDEX channel_id_index;
@@ -0,0 +1,20 @@
+-- Every lookup and write of a calc, for the stats.
+CREATE TABLE irc_calc_lookups
+(
+    id       BIGSERIAL    NOT NULL PRIMARY KEY,
+    channel  VARCHAR(100) NOT NULL,
+    "key"    VARCHAR(100) NOT NULL,
+    norm_key VARCHAR(200) NOT NULL,
+    nick     VARCHAR(255) NOT NULL,
+    hit      BOOLEAN      NOT NULL,
+    write    BOOLEAN      NOT NULL,
+    "when"   TIMESTAMP    NOT NULL
+);
+
+CREATE INDEX lookups_channel_when_index
+    ON irc_calc_lookups USING BTREE (channel, "when");
+
+---- create above / drop below ----
+
+DROP INDEX lookups_channel_when_index;
+DROP TABLE irc_calc_lookups;
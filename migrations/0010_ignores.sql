@@ -0,0 +1,13 @@
+-- Nicks the bot does not answer, by "nick!user@host" masks or "$a:account".
+-- Read-only ones may look calcs up but not change them.
+CREATE TABLE irc_ignores
+(
+    mask      VARCHAR(255) NOT NULL PRIMARY KEY,
+    read_only BOOLEAN      NOT NULL,
+    "by"      VARCHAR(255) NOT NULL,
+    "when"    TIMESTAMP    NOT NULL
+);
+
+---- create above / drop below ----
+
+DROP TABLE irc_ignores;
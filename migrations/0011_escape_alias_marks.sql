@@ -0,0 +1,36 @@
+-- Content starting with "@" is an alias, "@@" escapes the mark. Rows which
+-- started with "@" before aliases existed, or whose target is gone, are
+-- escaped to be shown as text. The keys are matched approximately, as in
+-- 0006_norm_key.sql, and in any channel since the global one is not known
+-- here. The rows escaped are kept to be restored by the down migration.
+CREATE TABLE irc_calcs_escaped
+(
+    calc_id BIGINT NOT NULL PRIMARY KEY
+);
+
+WITH escaped AS (
+    UPDATE irc_calcs c
+        SET content = '@' || c.content
+        WHERE c.content LIKE '@%'
+            AND c.content NOT LIKE '@@%'
+            AND length(c.content) < 1024
+            AND NOT EXISTS(SELECT 1
+                           FROM irc_calcs t
+                           WHERE t.norm_key = lower(regexp_replace(btrim(substr(c.content, 2)), '\s+', ' ', 'g'))
+                             AND t.deleted_at IS NULL)
+        RETURNING c.id)
+INSERT
+INTO irc_calcs_escaped (calc_id)
+SELECT id
+FROM escaped;
+
+---- create above / drop below ----
+
+-- only the rows escaped by the migration, content escaped by hand is kept
+UPDATE irc_calcs c
+SET content = substr(c.content, 2)
+FROM irc_calcs_escaped e
+WHERE c.id = e.calc_id
+  AND c.content LIKE '@@%';
+
+DROP TABLE irc_calcs_escaped;
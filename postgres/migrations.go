@@ -5,14 +5,19 @@ import (
 	"embed"
 	"os"
 	"path/filepath"
+	"regexp"
 
+	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/jackc/tern/migrate"
+	"github.com/pkg/errors"
 
 	"github.com/adzip-kadum/irc-calc/log"
 )
 
 const migrationsTable = "migrations"
 
+var identifier = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
 func MigrateTo(conf ClientConfig, dir embed.FS, target int32) error {
 	pool, err := NewPgxPool(conf)
 	if err != nil {
@@ -39,6 +44,13 @@ func MigrateTo(conf ClientConfig, dir embed.FS, target int32) error {
 		return err
 	}
 
+	// the name is pasted into the migrations
+	if err := checkTextSearchConfig(ctx, conn, conf.TextSearchConfig); err != nil {
+		log.Error(err)
+		return err
+	}
+	migrator.Data["textSearchConfig"] = conf.TextSearchConfig
+
 	err = migrator.LoadMigrations(".")
 	if err != nil {
 		log.Error(err)
@@ -80,6 +92,25 @@ func MigrateTo(conf ClientConfig, dir embed.FS, target int32) error {
 	return nil
 }
 
+// checkTextSearchConfig makes sure the text search configuration, if any, is
+// one of the configurations of the database.
+func checkTextSearchConfig(ctx context.Context, conn *pgxpool.Conn, name string) error {
+	if name == "" {
+		return nil
+	}
+	if !identifier.MatchString(name) {
+		return errors.Errorf("invalid text search configuration %q", name)
+	}
+	count, err := readInt(ctx, conn, "SELECT COUNT(*) FROM pg_ts_config WHERE cfgname = $1", name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if count == 0 {
+		return errors.Errorf("unknown text search configuration %q", name)
+	}
+	return nil
+}
+
 type migratorFS struct {
 	embed.FS
 }
@@ -25,6 +25,7 @@ type ClientConfig struct {
 	PoolHealthCheckPeriod time.Duration `yaml:"poolHealthCheckPeriod"`
 	PoolLazyConnect       bool          `yaml:"poolLazyConnect"`
 	LogLevel              string        `yaml:"logLevel"`
+	TextSearchConfig      string        `yaml:"textSearchConfig"`
 }
 
 type PgxPool struct {
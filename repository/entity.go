@@ -2,12 +2,30 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"math/rand"
+	"time"
 
 	"github.com/adzip-kadum/irc-calc/errs"
+	"github.com/adzip-kadum/irc-calc/log"
 	"github.com/adzip-kadum/irc-calc/postgres"
+	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
 )
 
+const (
+	AuditDelete   = "delete"
+	AuditUndelete = "undelete"
+)
+
+// Stats are the usage statistics of a channel.
+type Stats struct {
+	Keys         int64
+	TopKeys      []GetTopKeysRow
+	Contributors []GetTopContributorsRow
+	Misses       []GetTopMissesRow
+}
+
 type CalcsRepository struct {
 	pool *postgres.PgxPool
 }
@@ -50,6 +68,531 @@ func (r *CalcsRepository) GetCalcs(ctx context.Context, params GetCalcsParams) (
 	return list, nil
 }
 
+// GetLatestCalcs returns the latest version of each of the keys, missing keys
+// are skipped.
+func (r *CalcsRepository) GetLatestCalcs(ctx context.Context, params GetLatestCalcsParams) (_ []IrcCalc, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	list, err := q.GetLatestCalcs(ctx, params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return list, nil
+}
+
+func (r *CalcsRepository) GetDeletedCalcs(ctx context.Context, params GetDeletedCalcsParams) (_ []IrcCalc, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	list, err := q.GetDeletedCalcs(ctx, params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return list, nil
+}
+
+// GetCalcVersions returns up to Lim versions of the key, skipping the Off
+// oldest ones, and the number of the versions of the key.
+func (r *CalcsRepository) GetCalcVersions(ctx context.Context, params GetCalcVersionsParams) (_ []IrcCalc, total int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	rows, err := q.GetCalcVersions(ctx, params)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	list := make([]IrcCalc, 0, len(rows))
+	for _, row := range rows {
+		list = append(list, IrcCalc{
+			ID:         row.ID,
+			Channel:    row.Channel,
+			Key:        row.Key,
+			By:         row.By,
+			When:       row.When,
+			Content:    row.Content,
+			DeletedAt:  row.DeletedAt,
+			DeletedBy:  row.DeletedBy,
+			ContentTsv: row.ContentTsv,
+			NormKey:    row.NormKey,
+		})
+		total = row.Total
+	}
+	return list, total, nil
+}
+
+// GetNewestCalcVersion returns the newest version of the key and the number of
+// the versions of the key, which is zero if there are none.
+func (r *CalcsRepository) GetNewestCalcVersion(ctx context.Context, params GetNewestCalcVersionParams) (_ IrcCalc, total int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return IrcCalc{}, 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	row, err := q.GetNewestCalcVersion(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return IrcCalc{}, 0, nil
+	}
+	if err != nil {
+		return IrcCalc{}, 0, errors.WithStack(err)
+	}
+	return IrcCalc{
+		ID:         row.ID,
+		Channel:    row.Channel,
+		Key:        row.Key,
+		By:         row.By,
+		When:       row.When,
+		Content:    row.Content,
+		DeletedAt:  row.DeletedAt,
+		DeletedBy:  row.DeletedBy,
+		ContentTsv: row.ContentTsv,
+		NormKey:    row.NormKey,
+	}, row.Total, nil
+}
+
+// GetRandomCalc returns a random version of a key of the channel containing
+// the pattern and not picked since the time. Random ids are sought to avoid
+// sorting the table, keys with more versions are more likely to be picked.
+// With a pattern the key trigram index finds the matching keys and the pick
+// is made among their newest versions. It reports false if there are no such
+// keys.
+func (r *CalcsRepository) GetRandomCalc(ctx context.Context, channel, pattern string, since time.Time) (_ IrcCalc, _ bool, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return IrcCalc{}, false, errors.WithStack(err)
+	}
+	defer closer()
+
+	if pattern != "" {
+		c, err := q.GetRandomMatchingCalc(ctx, GetRandomMatchingCalcParams{
+			Channel: channel,
+			Like:    escapeLike(pattern),
+			Since:   since,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return IrcCalc{}, false, nil
+		}
+		if err != nil {
+			return IrcCalc{}, false, errors.WithStack(err)
+		}
+		return c, true, nil
+	}
+
+	ids, err := q.GetCalcIDRange(ctx, channel)
+	if err != nil {
+		return IrcCalc{}, false, errors.WithStack(err)
+	}
+	if ids.MaxID == 0 {
+		return IrcCalc{}, false, nil
+	}
+	params := GetRandomCalcParams{
+		Channel: channel,
+		FromID:  ids.MinID + rand.Int63n(ids.MaxID-ids.MinID+1),
+		Since:   since,
+	}
+	for {
+		c, err := q.GetRandomCalc(ctx, params)
+		if err == nil {
+			return c, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return IrcCalc{}, false, errors.WithStack(err)
+		}
+		if params.FromID == ids.MinID {
+			return IrcCalc{}, false, nil
+		}
+		// nothing after the random id, start over from the first one
+		params.FromID = ids.MinID
+	}
+}
+
+func (r *CalcsRepository) AddCalcPick(ctx context.Context, params AddCalcPickParams) (reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	return errors.WithStack(q.AddCalcPick(ctx, params))
+}
+
+func (r *CalcsRepository) CountCalcPicks(ctx context.Context, params CountCalcPicksParams) (_ int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	count, err := q.CountCalcPicks(ctx, params)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return count, nil
+}
+
+// DeleteCalcPicks forgets the picks older than the time.
+func (r *CalcsRepository) DeleteCalcPicks(ctx context.Context, before time.Time) (_ int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	deleted, err := q.DeleteCalcPicks(ctx, before)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return deleted, nil
+}
+
+// DeleteCalcs soft-deletes the calcs and records every deleted row in the
+// audit table. Rows that are already deleted are skipped.
+func (r *CalcsRepository) DeleteCalcs(ctx context.Context, calcs []IrcCalc, by string, when time.Time) (deleted int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	err := inTx(ctx, r.pool, func(ctx context.Context, q *Queries) error {
+		for _, c := range calcs {
+			n, err := q.DeleteCalc(ctx, DeleteCalcParams{
+				DeletedAt: sql.NullTime{Time: when, Valid: true},
+				DeletedBy: sql.NullString{String: by, Valid: true},
+				ID:        c.ID,
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if n == 0 {
+				continue
+			}
+			if err := q.AddAudit(ctx, newAudit(c, AuditDelete, by, when)); err != nil {
+				return errors.WithStack(err)
+			}
+			deleted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// UndeleteCalcs restores soft-deleted calcs and records every restored row in
+// the audit table.
+func (r *CalcsRepository) UndeleteCalcs(ctx context.Context, calcs []IrcCalc, by string, when time.Time) (restored int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	err := inTx(ctx, r.pool, func(ctx context.Context, q *Queries) error {
+		for _, c := range calcs {
+			n, err := q.UndeleteCalc(ctx, c.ID)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if n == 0 {
+				continue
+			}
+			if err := q.AddAudit(ctx, newAudit(c, AuditUndelete, by, when)); err != nil {
+				return errors.WithStack(err)
+			}
+			restored += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return restored, nil
+}
+
+func (r *CalcsRepository) GetAudit(ctx context.Context, params GetAuditParams) (_ []IrcCalcsAudit, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	list, err := q.GetAudit(ctx, params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return list, nil
+}
+
+func (r *CalcsRepository) SearchKeys(ctx context.Context, params SearchKeysParams) (_ []SearchKeysRow, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	params.Like = escapeLike(params.Pattern)
+	list, err := q.SearchKeys(ctx, params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return list, nil
+}
+
+func (r *CalcsRepository) SearchCalcContent(ctx context.Context, params SearchCalcContentParams) (_ []SearchCalcContentRow, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	list, err := q.SearchCalcContent(ctx, params)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return list, nil
+}
+
+// NormalizeKeys recomputes the normalized keys of all the calcs, a batch of
+// rows per transaction. normalize returns the normalized key in the channel.
+// It reports how many rows were changed.
+func (r *CalcsRepository) NormalizeKeys(ctx context.Context, normalize func(channel, key string) string, batch int32) (updated int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	var after int64
+	for {
+		var rows []GetCalcKeysRow
+		var changed int64
+		err := inTx(ctx, r.pool, func(ctx context.Context, q *Queries) error {
+			var err error
+			rows, err = q.GetCalcKeys(ctx, GetCalcKeysParams{After: after, Lim: batch})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			for _, row := range rows {
+				n, err := q.SetCalcNormKey(ctx, SetCalcNormKeyParams{
+					NormKey: normalize(row.Channel, row.Key),
+					ID:      row.ID,
+				})
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				changed += n
+			}
+			return nil
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated += changed
+		if len(rows) < int(batch) {
+			return updated, nil
+		}
+		after = rows[len(rows)-1].ID
+	}
+}
+
+// AddLookups records the lookups with a single query.
+func (r *CalcsRepository) AddLookups(ctx context.Context, lookups []IrcCalcLookup) (reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	var params AddLookupsParams
+	for _, l := range lookups {
+		params.Channels = append(params.Channels, l.Channel)
+		params.Keys = append(params.Keys, l.Key)
+		params.NormKeys = append(params.NormKeys, l.NormKey)
+		params.Nicks = append(params.Nicks, l.Nick)
+		params.Hits = append(params.Hits, l.Hit)
+		params.Writes = append(params.Writes, l.Write)
+		params.Whens = append(params.Whens, l.When)
+	}
+	return errors.WithStack(q.AddLookups(ctx, params))
+}
+
+// GetStats returns the number of keys of the channel, the most looked up
+// keys, the most missed ones since the time and the nicks who wrote the most
+// versions, up to limit of each.
+func (r *CalcsRepository) GetStats(ctx context.Context, channel string, since time.Time, limit int32) (_ Stats, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	defer closer()
+
+	var stats Stats
+	if stats.Keys, err = q.CountKeys(ctx, channel); err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	stats.TopKeys, err = q.GetTopKeys(ctx, GetTopKeysParams{Channel: channel, Since: since, Lim: limit})
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	stats.Contributors, err = q.GetTopContributors(ctx, GetTopContributorsParams{Channel: channel, Lim: limit})
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	stats.Misses, err = q.GetTopMisses(ctx, GetTopMissesParams{Channel: channel, Since: since, Lim: limit})
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+	return stats, nil
+}
+
+// GetNickEncoding returns the encoding set by the nick or an empty string.
+func (r *CalcsRepository) GetNickEncoding(ctx context.Context, nick string) (_ string, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer closer()
+
+	encoding, err := q.GetNickEncoding(ctx, nick)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return encoding, nil
+}
+
+func (r *CalcsRepository) SetNickEncoding(ctx context.Context, params SetNickEncodingParams) (reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	return errors.WithStack(q.SetNickEncoding(ctx, params))
+}
+
+func (r *CalcsRepository) DeleteNickEncoding(ctx context.Context, nick string) (_ int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	deleted, err := q.DeleteNickEncoding(ctx, nick)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return deleted, nil
+}
+
+func (r *CalcsRepository) GetIgnores(ctx context.Context) (_ []IrcIgnore, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer closer()
+
+	ignores, err := q.GetIgnores(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ignores, nil
+}
+
+func (r *CalcsRepository) SetIgnore(ctx context.Context, params SetIgnoreParams) (reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer closer()
+
+	return errors.WithStack(q.SetIgnore(ctx, params))
+}
+
+func (r *CalcsRepository) DeleteIgnore(ctx context.Context, mask string) (_ int64, reterr error) {
+	defer errs.Recover(&reterr)
+
+	q, closer, err := getDB(ctx, r.pool)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer closer()
+
+	deleted, err := q.DeleteIgnore(ctx, mask)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return deleted, nil
+}
+
+func newAudit(c IrcCalc, action, by string, when time.Time) AddAuditParams {
+	return AddAuditParams{
+		CalcID:  c.ID,
+		Channel: c.Channel,
+		Key:     c.Key,
+		Action:  action,
+		By:      by,
+		When:    when,
+	}
+}
+
+// inTx runs f in the transaction from the context or in a new one, which is
+// committed if f succeeds.
+func inTx(ctx context.Context, pool *postgres.PgxPool, f func(context.Context, *Queries) error) error {
+	if tx := postgres.GetTx(ctx); tx != nil {
+		return f(ctx, New(tx))
+	}
+	ctx, err := pool.Begin(ctx, pgx.TxOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := f(ctx, New(postgres.GetTx(ctx))); err != nil {
+		if rerr := pool.Rollback(ctx); rerr != nil {
+			log.Error(rerr)
+		}
+		return err
+	}
+	return errors.WithStack(pool.Commit(ctx))
+}
+
 func getDB(ctx context.Context, pool *postgres.PgxPool) (*Queries, func(), error) {
 	tx := postgres.GetTx(ctx)
 	if tx != nil {
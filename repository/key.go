@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// escapeLike escapes the wildcards of LIKE patterns, the text is matched
+// literally.
+func escapeLike(text string) string {
+	return likeEscaper.Replace(text)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// NormalizeKey returns the form keys are matched by: NFC normalized, case
+// folded, with the whitespace collapsed and, with foldYo, "ё" read as "е".
+func NormalizeKey(key string, foldYo bool) string {
+	key = strings.Join(strings.Fields(key), " ")
+	key = norm.NFC.String(cases.Fold().String(norm.NFC.String(key)))
+	if foldYo {
+		key = strings.ReplaceAll(key, "ё", "е")
+	}
+	return key
+}
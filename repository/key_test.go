@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"Nginx":           "nginx",
+		"  NGINX   conf ": "nginx conf",
+		"Ёлка":            "ёлка",
+		"Ёлка":           "ёлка",
+		"Straße":          "strasse",
+	} {
+		assert.Equal(t, want, NormalizeKey(key, false), key)
+	}
+	assert.Equal(t, "елка", NormalizeKey("ЁЛКА", true))
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, `100\% \_id C:\\dir`, escapeLike(`100% _id C:\dir`))
+	assert.Equal(t, "plain", escapeLike("plain"))
+}
@@ -3,16 +3,66 @@
 package repository
 
 import (
+	"database/sql"
 	"time"
 )
 
+type IrcCalcLookup struct {
+	ID      int64     `json:"id"`
+	Channel string    `json:"channel"`
+	Key     string    `json:"key"`
+	NormKey string    `json:"norm_key"`
+	Nick    string    `json:"nick"`
+	Hit     bool      `json:"hit"`
+	Write   bool      `json:"write"`
+	When    time.Time `json:"when"`
+}
+
+type IrcCalcPick struct {
+	Channel string    `json:"channel"`
+	NormKey string    `json:"norm_key"`
+	Kind    string    `json:"kind"`
+	When    time.Time `json:"when"`
+}
+
 type IrcCalc struct {
+	ID         int64          `json:"id"`
+	Channel    string         `json:"channel"`
+	Key        string         `json:"key"`
+	By         string         `json:"by"`
+	When       time.Time      `json:"when"`
+	Content    string         `json:"content"`
+	DeletedAt  sql.NullTime   `json:"deleted_at"`
+	DeletedBy  sql.NullString `json:"deleted_by"`
+	ContentTsv interface{}    `json:"content_tsv"`
+	NormKey    string         `json:"norm_key"`
+}
+
+type IrcCalcsAudit struct {
 	ID      int64     `json:"id"`
+	CalcID  int64     `json:"calc_id"`
 	Channel string    `json:"channel"`
 	Key     string    `json:"key"`
+	Action  string    `json:"action"`
 	By      string    `json:"by"`
 	When    time.Time `json:"when"`
-	Content string    `json:"content"`
+}
+
+type IrcCalcsEscaped struct {
+	CalcID int64 `json:"calc_id"`
+}
+
+type IrcIgnore struct {
+	Mask     string    `json:"mask"`
+	ReadOnly bool      `json:"read_only"`
+	By       string    `json:"by"`
+	When     time.Time `json:"when"`
+}
+
+type IrcNickEncoding struct {
+	Nick     string    `json:"nick"`
+	Encoding string    `json:"encoding"`
+	When     time.Time `json:"when"`
 }
 
 type Migration struct {
@@ -2,9 +2,251 @@
 SELECT *
 FROM irc_calcs
 WHERE channel = $1
-  AND "key" = $2
+  AND norm_key = $2
+  AND deleted_at IS NULL
 ORDER BY "when" ASC;
 
 -- name: AddCalc :one
-INSERT INTO irc_calcs (channel, "key", "by", "when", content)
-VALUES ($1, $2, $3, $4, $5) RETURNING id;
+INSERT INTO irc_calcs (channel, "key", norm_key, "by", "when", content)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+
+-- name: GetDeletedCalcs :many
+SELECT *
+FROM irc_calcs
+WHERE channel = $1
+  AND norm_key = $2
+  AND deleted_at IS NOT NULL
+ORDER BY "when" ASC;
+
+-- name: DeleteCalc :execrows
+UPDATE irc_calcs
+SET deleted_at = $1,
+    deleted_by = $2
+WHERE id = $3
+  AND deleted_at IS NULL;
+
+-- name: UndeleteCalc :execrows
+UPDATE irc_calcs
+SET deleted_at = NULL,
+    deleted_by = NULL
+WHERE id = $1
+  AND deleted_at IS NOT NULL;
+
+-- name: AddAudit :exec
+INSERT INTO irc_calcs_audit (calc_id, channel, "key", action, "by", "when")
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetAudit :many
+SELECT *
+FROM irc_calcs_audit
+WHERE channel = $1
+ORDER BY "when" DESC
+LIMIT $2;
+
+-- name: SearchKeys :many
+SELECT MAX("key")::varchar AS "key",
+       MAX(similarity("key", sqlc.arg(pattern)::text))::real               AS similarity,
+       MIN(levenshtein(lower("key"), lower(sqlc.arg(pattern)::text)))::int AS distance
+FROM irc_calcs
+WHERE channel = sqlc.arg(channel)
+  AND deleted_at IS NULL
+  AND ("key" % sqlc.arg(pattern)::text OR "key" ILIKE '%' || sqlc.arg(like)::text || '%')
+GROUP BY norm_key
+ORDER BY similarity DESC, distance ASC, norm_key ASC
+LIMIT sqlc.arg(lim);
+
+-- name: SearchCalcContent :many
+SELECT id, "key", "by", "when", content, ts_rank(content_tsv, query)::real AS rank
+FROM irc_calcs c,
+     websearch_to_tsquery(irc_calcs_ts_config(), sqlc.arg(words)::text) query
+WHERE c.channel = sqlc.arg(channel)
+  AND c.deleted_at IS NULL
+  AND c.content_tsv @@ query
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs newer
+                 WHERE newer.channel = c.channel
+                   AND newer.norm_key = c.norm_key
+                   AND newer.deleted_at IS NULL
+                   AND newer."when" > c."when")
+ORDER BY rank DESC, "when" DESC
+LIMIT sqlc.arg(lim);
+
+-- name: GetLatestCalcs :many
+SELECT DISTINCT ON (norm_key) *
+FROM irc_calcs
+WHERE channel = sqlc.arg(channel)
+  AND norm_key = ANY (sqlc.arg(norm_keys)::varchar[])
+  AND deleted_at IS NULL
+ORDER BY norm_key, "when" DESC;
+
+-- name: GetNickEncoding :one
+SELECT encoding
+FROM irc_nick_encodings
+WHERE nick = $1;
+
+-- name: SetNickEncoding :exec
+INSERT INTO irc_nick_encodings (nick, encoding, "when")
+VALUES ($1, $2, $3)
+ON CONFLICT (nick) DO UPDATE
+    SET encoding = excluded.encoding,
+        "when"   = excluded."when";
+
+-- name: DeleteNickEncoding :execrows
+DELETE
+FROM irc_nick_encodings
+WHERE nick = $1;
+
+-- name: GetIgnores :many
+SELECT mask, read_only, "by", "when"
+FROM irc_ignores
+ORDER BY mask;
+
+-- name: SetIgnore :exec
+INSERT INTO irc_ignores (mask, read_only, "by", "when")
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (mask) DO UPDATE
+    SET read_only = excluded.read_only,
+        "by"      = excluded."by",
+        "when"    = excluded."when";
+
+-- name: DeleteIgnore :execrows
+DELETE
+FROM irc_ignores
+WHERE mask = $1;
+
+-- name: GetCalcKeys :many
+SELECT id, channel, "key", norm_key
+FROM irc_calcs
+WHERE id > sqlc.arg(after)
+ORDER BY id
+LIMIT sqlc.arg(lim);
+
+-- name: SetCalcNormKey :execrows
+UPDATE irc_calcs
+SET norm_key = $1
+WHERE id = $2
+  AND norm_key <> $1;
+
+-- name: GetCalcVersions :many
+SELECT *, COUNT(*) OVER () AS total
+FROM irc_calcs
+WHERE channel = sqlc.arg(channel)
+  AND norm_key = sqlc.arg(norm_key)
+  AND deleted_at IS NULL
+ORDER BY "when" ASC
+OFFSET sqlc.arg(off) LIMIT sqlc.arg(lim);
+
+-- name: GetNewestCalcVersion :one
+SELECT *, COUNT(*) OVER () AS total
+FROM irc_calcs
+WHERE channel = sqlc.arg(channel)
+  AND norm_key = sqlc.arg(norm_key)
+  AND deleted_at IS NULL
+ORDER BY "when" DESC
+LIMIT 1;
+
+-- name: GetCalcIDRange :one
+SELECT COALESCE(MIN(id), 0)::bigint AS min_id, COALESCE(MAX(id), 0)::bigint AS max_id
+FROM irc_calcs
+WHERE channel = $1;
+
+-- name: GetRandomCalc :one
+SELECT c.*
+FROM irc_calcs c
+WHERE c.channel = sqlc.arg(channel)
+  AND c.id >= sqlc.arg(from_id)
+  AND c.deleted_at IS NULL
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calc_picks p
+                 WHERE p.channel = c.channel
+                   AND p.norm_key = c.norm_key
+                   AND p."when" > sqlc.arg(since))
+ORDER BY c.id
+LIMIT 1;
+
+-- name: GetRandomMatchingCalc :one
+SELECT c.*
+FROM irc_calcs c
+WHERE c.channel = sqlc.arg(channel)
+  AND c.deleted_at IS NULL
+  AND c."key" ILIKE '%' || sqlc.arg(like)::text || '%'
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs newer
+                 WHERE newer.channel = c.channel
+                   AND newer.norm_key = c.norm_key
+                   AND newer.deleted_at IS NULL
+                   AND newer."when" > c."when")
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calc_picks p
+                 WHERE p.channel = c.channel
+                   AND p.norm_key = c.norm_key
+                   AND p."when" > sqlc.arg(since))
+ORDER BY random()
+LIMIT 1;
+
+-- name: AddCalcPick :exec
+INSERT INTO irc_calc_picks (channel, norm_key, kind, "when")
+VALUES ($1, $2, $3, $4);
+
+-- name: CountCalcPicks :one
+SELECT COUNT(*)
+FROM irc_calc_picks
+WHERE channel = $1
+  AND kind = $2
+  AND "when" >= $3;
+
+-- name: DeleteCalcPicks :execrows
+DELETE
+FROM irc_calc_picks
+WHERE "when" < $1;
+
+-- name: AddLookups :exec
+INSERT INTO irc_calc_lookups (channel, "key", norm_key, nick, hit, write, "when")
+SELECT unnest(sqlc.arg(channels)::varchar[]),
+       unnest(sqlc.arg(keys)::varchar[]),
+       unnest(sqlc.arg(norm_keys)::varchar[]),
+       unnest(sqlc.arg(nicks)::varchar[]),
+       unnest(sqlc.arg(hits)::boolean[]),
+       unnest(sqlc.arg(writes)::boolean[]),
+       unnest(sqlc.arg(whens)::timestamp[]);
+
+-- name: CountKeys :one
+SELECT COUNT(DISTINCT norm_key)
+FROM irc_calcs
+WHERE channel = $1
+  AND deleted_at IS NULL;
+
+-- name: GetTopKeys :many
+SELECT MAX("key")::varchar AS "key", COUNT(*) AS lookups
+FROM irc_calc_lookups
+WHERE channel = sqlc.arg(channel)
+  AND hit
+  AND NOT write
+  AND "when" >= sqlc.arg(since)
+GROUP BY norm_key
+ORDER BY lookups DESC, norm_key
+LIMIT sqlc.arg(lim);
+
+-- name: GetTopContributors :many
+SELECT "by", COUNT(*) AS versions
+FROM irc_calcs
+WHERE channel = sqlc.arg(channel)
+  AND deleted_at IS NULL
+GROUP BY "by"
+ORDER BY versions DESC, "by"
+LIMIT sqlc.arg(lim);
+
+-- name: GetTopMisses :many
+SELECT MAX(l."key")::varchar AS "key", COUNT(DISTINCT l.nick) AS nicks, COUNT(*) AS lookups
+FROM irc_calc_lookups l
+WHERE l.channel = sqlc.arg(channel)
+  AND NOT l.hit
+  AND l."when" >= sqlc.arg(since)
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs c
+                 WHERE c.channel = l.channel
+                   AND c.norm_key = l.norm_key
+                   AND c.deleted_at IS NULL)
+GROUP BY l.norm_key
+ORDER BY nicks DESC, lookups DESC, l.norm_key
+LIMIT sqlc.arg(lim);
@@ -5,17 +5,45 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
+const addAudit = `-- name: AddAudit :exec
+INSERT INTO irc_calcs_audit (calc_id, channel, "key", action, "by", "when")
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type AddAuditParams struct {
+	CalcID  int64     `json:"calc_id"`
+	Channel string    `json:"channel"`
+	Key     string    `json:"key"`
+	Action  string    `json:"action"`
+	By      string    `json:"by"`
+	When    time.Time `json:"when"`
+}
+
+func (q *Queries) AddAudit(ctx context.Context, arg AddAuditParams) error {
+	_, err := q.db.Exec(ctx, addAudit,
+		arg.CalcID,
+		arg.Channel,
+		arg.Key,
+		arg.Action,
+		arg.By,
+		arg.When,
+	)
+	return err
+}
+
 const addCalc = `-- name: AddCalc :one
-INSERT INTO irc_calcs (channel, "key", "by", "when", content)
-VALUES ($1, $2, $3, $4, $5) RETURNING id
+INSERT INTO irc_calcs (channel, "key", norm_key, "by", "when", content)
+VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
 `
 
 type AddCalcParams struct {
 	Channel string    `json:"channel"`
 	Key     string    `json:"key"`
+	NormKey string    `json:"norm_key"`
 	By      string    `json:"by"`
 	When    time.Time `json:"when"`
 	Content string    `json:"content"`
@@ -25,6 +53,7 @@ func (q *Queries) AddCalc(ctx context.Context, arg AddCalcParams) (int64, error)
 	row := q.db.QueryRow(ctx, addCalc,
 		arg.Channel,
 		arg.Key,
+		arg.NormKey,
 		arg.By,
 		arg.When,
 		arg.Content,
@@ -34,21 +63,470 @@ func (q *Queries) AddCalc(ctx context.Context, arg AddCalcParams) (int64, error)
 	return id, err
 }
 
+const addCalcPick = `-- name: AddCalcPick :exec
+INSERT INTO irc_calc_picks (channel, norm_key, kind, "when")
+VALUES ($1, $2, $3, $4)
+`
+
+type AddCalcPickParams struct {
+	Channel string    `json:"channel"`
+	NormKey string    `json:"norm_key"`
+	Kind    string    `json:"kind"`
+	When    time.Time `json:"when"`
+}
+
+func (q *Queries) AddCalcPick(ctx context.Context, arg AddCalcPickParams) error {
+	_, err := q.db.Exec(ctx, addCalcPick,
+		arg.Channel,
+		arg.NormKey,
+		arg.Kind,
+		arg.When,
+	)
+	return err
+}
+
+const addLookups = `-- name: AddLookups :exec
+INSERT INTO irc_calc_lookups (channel, "key", norm_key, nick, hit, write, "when")
+SELECT unnest($1::varchar[]),
+       unnest($2::varchar[]),
+       unnest($3::varchar[]),
+       unnest($4::varchar[]),
+       unnest($5::boolean[]),
+       unnest($6::boolean[]),
+       unnest($7::timestamp[])
+`
+
+type AddLookupsParams struct {
+	Channels []string    `json:"channels"`
+	Keys     []string    `json:"keys"`
+	NormKeys []string    `json:"norm_keys"`
+	Nicks    []string    `json:"nicks"`
+	Hits     []bool      `json:"hits"`
+	Writes   []bool      `json:"writes"`
+	Whens    []time.Time `json:"whens"`
+}
+
+func (q *Queries) AddLookups(ctx context.Context, arg AddLookupsParams) error {
+	_, err := q.db.Exec(ctx, addLookups,
+		arg.Channels,
+		arg.Keys,
+		arg.NormKeys,
+		arg.Nicks,
+		arg.Hits,
+		arg.Writes,
+		arg.Whens,
+	)
+	return err
+}
+
+const countCalcPicks = `-- name: CountCalcPicks :one
+SELECT COUNT(*)
+FROM irc_calc_picks
+WHERE channel = $1
+  AND kind = $2
+  AND "when" >= $3
+`
+
+type CountCalcPicksParams struct {
+	Channel string    `json:"channel"`
+	Kind    string    `json:"kind"`
+	When    time.Time `json:"when"`
+}
+
+func (q *Queries) CountCalcPicks(ctx context.Context, arg CountCalcPicksParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countCalcPicks, arg.Channel, arg.Kind, arg.When)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countKeys = `-- name: CountKeys :one
+SELECT COUNT(DISTINCT norm_key)
+FROM irc_calcs
+WHERE channel = $1
+  AND deleted_at IS NULL
+`
+
+func (q *Queries) CountKeys(ctx context.Context, channel string) (int64, error) {
+	row := q.db.QueryRow(ctx, countKeys, channel)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteCalc = `-- name: DeleteCalc :execrows
+UPDATE irc_calcs
+SET deleted_at = $1,
+    deleted_by = $2
+WHERE id = $3
+  AND deleted_at IS NULL
+`
+
+type DeleteCalcParams struct {
+	DeletedAt sql.NullTime   `json:"deleted_at"`
+	DeletedBy sql.NullString `json:"deleted_by"`
+	ID        int64          `json:"id"`
+}
+
+func (q *Queries) DeleteCalc(ctx context.Context, arg DeleteCalcParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCalc, arg.DeletedAt, arg.DeletedBy, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteCalcPicks = `-- name: DeleteCalcPicks :execrows
+DELETE
+FROM irc_calc_picks
+WHERE "when" < $1
+`
+
+func (q *Queries) DeleteCalcPicks(ctx context.Context, when time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCalcPicks, when)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteIgnore = `-- name: DeleteIgnore :execrows
+DELETE
+FROM irc_ignores
+WHERE mask = $1
+`
+
+func (q *Queries) DeleteIgnore(ctx context.Context, mask string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteIgnore, mask)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteNickEncoding = `-- name: DeleteNickEncoding :execrows
+DELETE
+FROM irc_nick_encodings
+WHERE nick = $1
+`
+
+func (q *Queries) DeleteNickEncoding(ctx context.Context, nick string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteNickEncoding, nick)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getAudit = `-- name: GetAudit :many
+SELECT id, calc_id, channel, key, action, by, "when"
+FROM irc_calcs_audit
+WHERE channel = $1
+ORDER BY "when" DESC
+LIMIT $2
+`
+
+type GetAuditParams struct {
+	Channel string `json:"channel"`
+	Limit   int32  `json:"limit"`
+}
+
+func (q *Queries) GetAudit(ctx context.Context, arg GetAuditParams) ([]IrcCalcsAudit, error) {
+	rows, err := q.db.Query(ctx, getAudit, arg.Channel, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IrcCalcsAudit
+	for rows.Next() {
+		var i IrcCalcsAudit
+		if err := rows.Scan(
+			&i.ID,
+			&i.CalcID,
+			&i.Channel,
+			&i.Key,
+			&i.Action,
+			&i.By,
+			&i.When,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCalcIDRange = `-- name: GetCalcIDRange :one
+SELECT COALESCE(MIN(id), 0)::bigint AS min_id, COALESCE(MAX(id), 0)::bigint AS max_id
+FROM irc_calcs
+WHERE channel = $1
+`
+
+type GetCalcIDRangeRow struct {
+	MinID int64 `json:"min_id"`
+	MaxID int64 `json:"max_id"`
+}
+
+func (q *Queries) GetCalcIDRange(ctx context.Context, channel string) (GetCalcIDRangeRow, error) {
+	row := q.db.QueryRow(ctx, getCalcIDRange, channel)
+	var i GetCalcIDRangeRow
+	err := row.Scan(&i.MinID, &i.MaxID)
+	return i, err
+}
+
+const getCalcKeys = `-- name: GetCalcKeys :many
+SELECT id, channel, "key", norm_key
+FROM irc_calcs
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type GetCalcKeysParams struct {
+	After int64 `json:"after"`
+	Lim   int32 `json:"lim"`
+}
+
+type GetCalcKeysRow struct {
+	ID      int64  `json:"id"`
+	Channel string `json:"channel"`
+	Key     string `json:"key"`
+	NormKey string `json:"norm_key"`
+}
+
+func (q *Queries) GetCalcKeys(ctx context.Context, arg GetCalcKeysParams) ([]GetCalcKeysRow, error) {
+	rows, err := q.db.Query(ctx, getCalcKeys, arg.After, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCalcKeysRow
+	for rows.Next() {
+		var i GetCalcKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Channel,
+			&i.Key,
+			&i.NormKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getCalcs = `-- name: GetCalcs :many
-SELECT id, channel, key, by, "when", content
+SELECT id, channel, key, by, "when", content, deleted_at, deleted_by, content_tsv, norm_key
 FROM irc_calcs
 WHERE channel = $1
-  AND "key" = $2
+  AND norm_key = $2
+  AND deleted_at IS NULL
 ORDER BY "when" ASC
 `
 
 type GetCalcsParams struct {
 	Channel string `json:"channel"`
-	Key     string `json:"key"`
+	NormKey string `json:"norm_key"`
 }
 
 func (q *Queries) GetCalcs(ctx context.Context, arg GetCalcsParams) ([]IrcCalc, error) {
-	rows, err := q.db.Query(ctx, getCalcs, arg.Channel, arg.Key)
+	rows, err := q.db.Query(ctx, getCalcs, arg.Channel, arg.NormKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IrcCalc
+	for rows.Next() {
+		var i IrcCalc
+		if err := rows.Scan(
+			&i.ID,
+			&i.Channel,
+			&i.Key,
+			&i.By,
+			&i.When,
+			&i.Content,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ContentTsv,
+			&i.NormKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getCalcVersions = `-- name: GetCalcVersions :many
+SELECT id, channel, key, by, "when", content, deleted_at, deleted_by, content_tsv, norm_key, COUNT(*) OVER () AS total
+FROM irc_calcs
+WHERE channel = $1
+  AND norm_key = $2
+  AND deleted_at IS NULL
+ORDER BY "when" ASC
+OFFSET $3 LIMIT $4
+`
+
+type GetCalcVersionsParams struct {
+	Channel string `json:"channel"`
+	NormKey string `json:"norm_key"`
+	Off     int32  `json:"off"`
+	Lim     int32  `json:"lim"`
+}
+
+type GetCalcVersionsRow struct {
+	ID         int64          `json:"id"`
+	Channel    string         `json:"channel"`
+	Key        string         `json:"key"`
+	By         string         `json:"by"`
+	When       time.Time      `json:"when"`
+	Content    string         `json:"content"`
+	DeletedAt  sql.NullTime   `json:"deleted_at"`
+	DeletedBy  sql.NullString `json:"deleted_by"`
+	ContentTsv interface{}    `json:"content_tsv"`
+	NormKey    string         `json:"norm_key"`
+	Total      int64          `json:"total"`
+}
+
+func (q *Queries) GetCalcVersions(ctx context.Context, arg GetCalcVersionsParams) ([]GetCalcVersionsRow, error) {
+	rows, err := q.db.Query(ctx, getCalcVersions,
+		arg.Channel,
+		arg.NormKey,
+		arg.Off,
+		arg.Lim,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetCalcVersionsRow
+	for rows.Next() {
+		var i GetCalcVersionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Channel,
+			&i.Key,
+			&i.By,
+			&i.When,
+			&i.Content,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ContentTsv,
+			&i.NormKey,
+			&i.Total,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedCalcs = `-- name: GetDeletedCalcs :many
+SELECT id, channel, key, by, "when", content, deleted_at, deleted_by, content_tsv, norm_key
+FROM irc_calcs
+WHERE channel = $1
+  AND norm_key = $2
+  AND deleted_at IS NOT NULL
+ORDER BY "when" ASC
+`
+
+type GetDeletedCalcsParams struct {
+	Channel string `json:"channel"`
+	NormKey string `json:"norm_key"`
+}
+
+func (q *Queries) GetDeletedCalcs(ctx context.Context, arg GetDeletedCalcsParams) ([]IrcCalc, error) {
+	rows, err := q.db.Query(ctx, getDeletedCalcs, arg.Channel, arg.NormKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IrcCalc
+	for rows.Next() {
+		var i IrcCalc
+		if err := rows.Scan(
+			&i.ID,
+			&i.Channel,
+			&i.Key,
+			&i.By,
+			&i.When,
+			&i.Content,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ContentTsv,
+			&i.NormKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getIgnores = `-- name: GetIgnores :many
+SELECT mask, read_only, "by", "when"
+FROM irc_ignores
+ORDER BY mask
+`
+
+func (q *Queries) GetIgnores(ctx context.Context) ([]IrcIgnore, error) {
+	rows, err := q.db.Query(ctx, getIgnores)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []IrcIgnore
+	for rows.Next() {
+		var i IrcIgnore
+		if err := rows.Scan(
+			&i.Mask,
+			&i.ReadOnly,
+			&i.By,
+			&i.When,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestCalcs = `-- name: GetLatestCalcs :many
+SELECT DISTINCT ON (norm_key) id, channel, key, by, "when", content, deleted_at, deleted_by, content_tsv, norm_key
+FROM irc_calcs
+WHERE channel = $1
+  AND norm_key = ANY ($2::varchar[])
+  AND deleted_at IS NULL
+ORDER BY norm_key, "when" DESC
+`
+
+type GetLatestCalcsParams struct {
+	Channel  string   `json:"channel"`
+	NormKeys []string `json:"norm_keys"`
+}
+
+func (q *Queries) GetLatestCalcs(ctx context.Context, arg GetLatestCalcsParams) ([]IrcCalc, error) {
+	rows, err := q.db.Query(ctx, getLatestCalcs, arg.Channel, arg.NormKeys)
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +541,10 @@ func (q *Queries) GetCalcs(ctx context.Context, arg GetCalcsParams) ([]IrcCalc,
 			&i.By,
 			&i.When,
 			&i.Content,
+			&i.DeletedAt,
+			&i.DeletedBy,
+			&i.ContentTsv,
+			&i.NormKey,
 		); err != nil {
 			return nil, err
 		}
@@ -73,3 +555,470 @@ func (q *Queries) GetCalcs(ctx context.Context, arg GetCalcsParams) ([]IrcCalc,
 	}
 	return items, nil
 }
+
+const getNewestCalcVersion = `-- name: GetNewestCalcVersion :one
+SELECT id, channel, key, by, "when", content, deleted_at, deleted_by, content_tsv, norm_key, COUNT(*) OVER () AS total
+FROM irc_calcs
+WHERE channel = $1
+  AND norm_key = $2
+  AND deleted_at IS NULL
+ORDER BY "when" DESC
+LIMIT 1
+`
+
+type GetNewestCalcVersionParams struct {
+	Channel string `json:"channel"`
+	NormKey string `json:"norm_key"`
+}
+
+type GetNewestCalcVersionRow struct {
+	ID         int64          `json:"id"`
+	Channel    string         `json:"channel"`
+	Key        string         `json:"key"`
+	By         string         `json:"by"`
+	When       time.Time      `json:"when"`
+	Content    string         `json:"content"`
+	DeletedAt  sql.NullTime   `json:"deleted_at"`
+	DeletedBy  sql.NullString `json:"deleted_by"`
+	ContentTsv interface{}    `json:"content_tsv"`
+	NormKey    string         `json:"norm_key"`
+	Total      int64          `json:"total"`
+}
+
+func (q *Queries) GetNewestCalcVersion(ctx context.Context, arg GetNewestCalcVersionParams) (GetNewestCalcVersionRow, error) {
+	row := q.db.QueryRow(ctx, getNewestCalcVersion, arg.Channel, arg.NormKey)
+	var i GetNewestCalcVersionRow
+	err := row.Scan(
+		&i.ID,
+		&i.Channel,
+		&i.Key,
+		&i.By,
+		&i.When,
+		&i.Content,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ContentTsv,
+		&i.NormKey,
+		&i.Total,
+	)
+	return i, err
+}
+
+const getNickEncoding = `-- name: GetNickEncoding :one
+SELECT encoding
+FROM irc_nick_encodings
+WHERE nick = $1
+`
+
+func (q *Queries) GetNickEncoding(ctx context.Context, nick string) (string, error) {
+	row := q.db.QueryRow(ctx, getNickEncoding, nick)
+	var encoding string
+	err := row.Scan(&encoding)
+	return encoding, err
+}
+
+const getRandomCalc = `-- name: GetRandomCalc :one
+SELECT c.id, c.channel, c.key, c.by, c."when", c.content, c.deleted_at, c.deleted_by, c.content_tsv, c.norm_key
+FROM irc_calcs c
+WHERE c.channel = $1
+  AND c.id >= $2
+  AND c.deleted_at IS NULL
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calc_picks p
+                 WHERE p.channel = c.channel
+                   AND p.norm_key = c.norm_key
+                   AND p."when" > $3)
+ORDER BY c.id
+LIMIT 1
+`
+
+type GetRandomCalcParams struct {
+	Channel string    `json:"channel"`
+	FromID  int64     `json:"from_id"`
+	Since   time.Time `json:"since"`
+}
+
+func (q *Queries) GetRandomCalc(ctx context.Context, arg GetRandomCalcParams) (IrcCalc, error) {
+	row := q.db.QueryRow(ctx, getRandomCalc, arg.Channel, arg.FromID, arg.Since)
+	var i IrcCalc
+	err := row.Scan(
+		&i.ID,
+		&i.Channel,
+		&i.Key,
+		&i.By,
+		&i.When,
+		&i.Content,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ContentTsv,
+		&i.NormKey,
+	)
+	return i, err
+}
+
+const getRandomMatchingCalc = `-- name: GetRandomMatchingCalc :one
+SELECT c.id, c.channel, c.key, c.by, c."when", c.content, c.deleted_at, c.deleted_by, c.content_tsv, c.norm_key
+FROM irc_calcs c
+WHERE c.channel = $1
+  AND c.deleted_at IS NULL
+  AND c."key" ILIKE '%' || $2::text || '%'
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs newer
+                 WHERE newer.channel = c.channel
+                   AND newer.norm_key = c.norm_key
+                   AND newer.deleted_at IS NULL
+                   AND newer."when" > c."when")
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calc_picks p
+                 WHERE p.channel = c.channel
+                   AND p.norm_key = c.norm_key
+                   AND p."when" > $3)
+ORDER BY random()
+LIMIT 1
+`
+
+type GetRandomMatchingCalcParams struct {
+	Channel string    `json:"channel"`
+	Like    string    `json:"like"`
+	Since   time.Time `json:"since"`
+}
+
+func (q *Queries) GetRandomMatchingCalc(ctx context.Context, arg GetRandomMatchingCalcParams) (IrcCalc, error) {
+	row := q.db.QueryRow(ctx, getRandomMatchingCalc, arg.Channel, arg.Like, arg.Since)
+	var i IrcCalc
+	err := row.Scan(
+		&i.ID,
+		&i.Channel,
+		&i.Key,
+		&i.By,
+		&i.When,
+		&i.Content,
+		&i.DeletedAt,
+		&i.DeletedBy,
+		&i.ContentTsv,
+		&i.NormKey,
+	)
+	return i, err
+}
+
+const getTopContributors = `-- name: GetTopContributors :many
+SELECT "by", COUNT(*) AS versions
+FROM irc_calcs
+WHERE channel = $1
+  AND deleted_at IS NULL
+GROUP BY "by"
+ORDER BY versions DESC, "by"
+LIMIT $2
+`
+
+type GetTopContributorsParams struct {
+	Channel string `json:"channel"`
+	Lim     int32  `json:"lim"`
+}
+
+type GetTopContributorsRow struct {
+	By       string `json:"by"`
+	Versions int64  `json:"versions"`
+}
+
+func (q *Queries) GetTopContributors(ctx context.Context, arg GetTopContributorsParams) ([]GetTopContributorsRow, error) {
+	rows, err := q.db.Query(ctx, getTopContributors, arg.Channel, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopContributorsRow
+	for rows.Next() {
+		var i GetTopContributorsRow
+		if err := rows.Scan(&i.By, &i.Versions); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopKeys = `-- name: GetTopKeys :many
+SELECT MAX("key")::varchar AS "key", COUNT(*) AS lookups
+FROM irc_calc_lookups
+WHERE channel = $1
+  AND hit
+  AND NOT write
+  AND "when" >= $2
+GROUP BY norm_key
+ORDER BY lookups DESC, norm_key
+LIMIT $3
+`
+
+type GetTopKeysParams struct {
+	Channel string    `json:"channel"`
+	Since   time.Time `json:"since"`
+	Lim     int32     `json:"lim"`
+}
+
+type GetTopKeysRow struct {
+	Key     string `json:"key"`
+	Lookups int64  `json:"lookups"`
+}
+
+func (q *Queries) GetTopKeys(ctx context.Context, arg GetTopKeysParams) ([]GetTopKeysRow, error) {
+	rows, err := q.db.Query(ctx, getTopKeys, arg.Channel, arg.Since, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopKeysRow
+	for rows.Next() {
+		var i GetTopKeysRow
+		if err := rows.Scan(&i.Key, &i.Lookups); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTopMisses = `-- name: GetTopMisses :many
+SELECT MAX(l."key")::varchar AS "key", COUNT(DISTINCT l.nick) AS nicks, COUNT(*) AS lookups
+FROM irc_calc_lookups l
+WHERE l.channel = $1
+  AND NOT l.hit
+  AND l."when" >= $2
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs c
+                 WHERE c.channel = l.channel
+                   AND c.norm_key = l.norm_key
+                   AND c.deleted_at IS NULL)
+GROUP BY l.norm_key
+ORDER BY nicks DESC, lookups DESC, l.norm_key
+LIMIT $3
+`
+
+type GetTopMissesParams struct {
+	Channel string    `json:"channel"`
+	Since   time.Time `json:"since"`
+	Lim     int32     `json:"lim"`
+}
+
+type GetTopMissesRow struct {
+	Key     string `json:"key"`
+	Nicks   int64  `json:"nicks"`
+	Lookups int64  `json:"lookups"`
+}
+
+func (q *Queries) GetTopMisses(ctx context.Context, arg GetTopMissesParams) ([]GetTopMissesRow, error) {
+	rows, err := q.db.Query(ctx, getTopMisses, arg.Channel, arg.Since, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTopMissesRow
+	for rows.Next() {
+		var i GetTopMissesRow
+		if err := rows.Scan(&i.Key, &i.Nicks, &i.Lookups); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchCalcContent = `-- name: SearchCalcContent :many
+SELECT id, "key", "by", "when", content, ts_rank(content_tsv, query)::real AS rank
+FROM irc_calcs c,
+     websearch_to_tsquery(irc_calcs_ts_config(), $1::text) query
+WHERE c.channel = $2
+  AND c.deleted_at IS NULL
+  AND c.content_tsv @@ query
+  AND NOT EXISTS(SELECT 1
+                 FROM irc_calcs newer
+                 WHERE newer.channel = c.channel
+                   AND newer.norm_key = c.norm_key
+                   AND newer.deleted_at IS NULL
+                   AND newer."when" > c."when")
+ORDER BY rank DESC, "when" DESC
+LIMIT $3
+`
+
+type SearchCalcContentParams struct {
+	Words   string `json:"words"`
+	Channel string `json:"channel"`
+	Lim     int32  `json:"lim"`
+}
+
+type SearchCalcContentRow struct {
+	ID      int64     `json:"id"`
+	Key     string    `json:"key"`
+	By      string    `json:"by"`
+	When    time.Time `json:"when"`
+	Content string    `json:"content"`
+	Rank    float32   `json:"rank"`
+}
+
+func (q *Queries) SearchCalcContent(ctx context.Context, arg SearchCalcContentParams) ([]SearchCalcContentRow, error) {
+	rows, err := q.db.Query(ctx, searchCalcContent, arg.Words, arg.Channel, arg.Lim)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchCalcContentRow
+	for rows.Next() {
+		var i SearchCalcContentRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Key,
+			&i.By,
+			&i.When,
+			&i.Content,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchKeys = `-- name: SearchKeys :many
+SELECT MAX("key")::varchar AS "key",
+       MAX(similarity("key", $1::text))::real               AS similarity,
+       MIN(levenshtein(lower("key"), lower($1::text)))::int AS distance
+FROM irc_calcs
+WHERE channel = $2
+  AND deleted_at IS NULL
+  AND ("key" % $1::text OR "key" ILIKE '%' || $3::text || '%')
+GROUP BY norm_key
+ORDER BY similarity DESC, distance ASC, norm_key ASC
+LIMIT $4
+`
+
+type SearchKeysParams struct {
+	Pattern string `json:"pattern"`
+	Channel string `json:"channel"`
+	Like    string `json:"like"`
+	Lim     int32  `json:"lim"`
+}
+
+type SearchKeysRow struct {
+	Key        string  `json:"key"`
+	Similarity float32 `json:"similarity"`
+	Distance   int32   `json:"distance"`
+}
+
+func (q *Queries) SearchKeys(ctx context.Context, arg SearchKeysParams) ([]SearchKeysRow, error) {
+	rows, err := q.db.Query(ctx, searchKeys,
+		arg.Pattern,
+		arg.Channel,
+		arg.Like,
+		arg.Lim,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchKeysRow
+	for rows.Next() {
+		var i SearchKeysRow
+		if err := rows.Scan(&i.Key, &i.Similarity, &i.Distance); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setCalcNormKey = `-- name: SetCalcNormKey :execrows
+UPDATE irc_calcs
+SET norm_key = $1
+WHERE id = $2
+  AND norm_key <> $1
+`
+
+type SetCalcNormKeyParams struct {
+	NormKey string `json:"norm_key"`
+	ID      int64  `json:"id"`
+}
+
+func (q *Queries) SetCalcNormKey(ctx context.Context, arg SetCalcNormKeyParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setCalcNormKey, arg.NormKey, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setIgnore = `-- name: SetIgnore :exec
+INSERT INTO irc_ignores (mask, read_only, "by", "when")
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (mask) DO UPDATE
+    SET read_only = excluded.read_only,
+        "by"      = excluded."by",
+        "when"    = excluded."when"
+`
+
+type SetIgnoreParams struct {
+	Mask     string    `json:"mask"`
+	ReadOnly bool      `json:"read_only"`
+	By       string    `json:"by"`
+	When     time.Time `json:"when"`
+}
+
+func (q *Queries) SetIgnore(ctx context.Context, arg SetIgnoreParams) error {
+	_, err := q.db.Exec(ctx, setIgnore,
+		arg.Mask,
+		arg.ReadOnly,
+		arg.By,
+		arg.When,
+	)
+	return err
+}
+
+const setNickEncoding = `-- name: SetNickEncoding :exec
+INSERT INTO irc_nick_encodings (nick, encoding, "when")
+VALUES ($1, $2, $3)
+ON CONFLICT (nick) DO UPDATE
+    SET encoding = excluded.encoding,
+        "when"   = excluded."when"
+`
+
+type SetNickEncodingParams struct {
+	Nick     string    `json:"nick"`
+	Encoding string    `json:"encoding"`
+	When     time.Time `json:"when"`
+}
+
+func (q *Queries) SetNickEncoding(ctx context.Context, arg SetNickEncodingParams) error {
+	_, err := q.db.Exec(ctx, setNickEncoding, arg.Nick, arg.Encoding, arg.When)
+	return err
+}
+
+const undeleteCalc = `-- name: UndeleteCalc :execrows
+UPDATE irc_calcs
+SET deleted_at = NULL,
+    deleted_by = NULL
+WHERE id = $1
+  AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) UndeleteCalc(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, undeleteCalc, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
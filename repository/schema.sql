@@ -64,6 +64,20 @@ CREATE EXTENSION IF NOT EXISTS fuzzystrmatch WITH SCHEMA public;
 COMMENT ON EXTENSION fuzzystrmatch IS 'determine similarities and distance between strings';
 
 
+--
+-- Name: pg_trgm; Type: EXTENSION; Schema: -; Owner: -
+--
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm WITH SCHEMA public;
+
+
+--
+-- Name: EXTENSION pg_trgm; Type: COMMENT; Schema: -; Owner: 
+--
+
+COMMENT ON EXTENSION pg_trgm IS 'text similarity measurement and index searching based on trigrams';
+
+
 --
 -- Name: postgis; Type: EXTENSION; Schema: -; Owner: -
 --
@@ -106,10 +120,76 @@ CREATE EXTENSION IF NOT EXISTS postgis_topology WITH SCHEMA topology;
 COMMENT ON EXTENSION postgis_topology IS 'PostGIS topology spatial types and functions';
 
 
+--
+-- Name: irc_calcs_ts_config(); Type: FUNCTION; Schema: public; Owner: root
+--
+
+CREATE FUNCTION public.irc_calcs_ts_config() RETURNS regconfig
+    LANGUAGE sql IMMUTABLE
+    AS $$
+SELECT 'russian'::regconfig
+$$;
+
+
+ALTER FUNCTION public.irc_calcs_ts_config() OWNER TO root;
+
 SET default_tablespace = '';
 
 SET default_table_access_method = heap;
 
+--
+-- Name: irc_calc_lookups; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_calc_lookups (
+    id bigint NOT NULL,
+    channel character varying(100) NOT NULL,
+    key character varying(100) NOT NULL,
+    norm_key character varying(200) NOT NULL,
+    nick character varying(255) NOT NULL,
+    hit boolean NOT NULL,
+    write boolean NOT NULL,
+    "when" timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.irc_calc_lookups OWNER TO root;
+
+--
+-- Name: irc_calc_lookups_id_seq; Type: SEQUENCE; Schema: public; Owner: root
+--
+
+CREATE SEQUENCE public.irc_calc_lookups_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.irc_calc_lookups_id_seq OWNER TO root;
+
+--
+-- Name: irc_calc_lookups_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: root
+--
+
+ALTER SEQUENCE public.irc_calc_lookups_id_seq OWNED BY public.irc_calc_lookups.id;
+
+
+--
+-- Name: irc_calc_picks; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_calc_picks (
+    channel character varying(100) NOT NULL,
+    norm_key character varying(200) NOT NULL,
+    kind character varying(32) NOT NULL,
+    "when" timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.irc_calc_picks OWNER TO root;
+
 --
 -- Name: irc_calcs; Type: TABLE; Schema: public; Owner: root
 --
@@ -120,7 +200,11 @@ CREATE TABLE public.irc_calcs (
     key character varying(100) NOT NULL,
     by character varying(255) NOT NULL,
     "when" timestamp without time zone NOT NULL,
-    content character varying(1024) NOT NULL
+    content character varying(1024) NOT NULL,
+    deleted_at timestamp without time zone,
+    deleted_by character varying(255),
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector(public.irc_calcs_ts_config(), (content)::text)) STORED,
+    norm_key character varying(200) NOT NULL
 );
 
 
@@ -147,6 +231,82 @@ ALTER TABLE public.irc_calcs_id_seq OWNER TO root;
 ALTER SEQUENCE public.irc_calcs_id_seq OWNED BY public.irc_calcs.id;
 
 
+--
+-- Name: irc_calcs_audit; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_calcs_audit (
+    id bigint NOT NULL,
+    calc_id bigint NOT NULL,
+    channel character varying(100) NOT NULL,
+    key character varying(100) NOT NULL,
+    action character varying(16) NOT NULL,
+    by character varying(255) NOT NULL,
+    "when" timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.irc_calcs_audit OWNER TO root;
+
+--
+-- Name: irc_calcs_audit_id_seq; Type: SEQUENCE; Schema: public; Owner: root
+--
+
+CREATE SEQUENCE public.irc_calcs_audit_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.irc_calcs_audit_id_seq OWNER TO root;
+
+--
+-- Name: irc_calcs_audit_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: root
+--
+
+ALTER SEQUENCE public.irc_calcs_audit_id_seq OWNED BY public.irc_calcs_audit.id;
+
+
+--
+-- Name: irc_calcs_escaped; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_calcs_escaped (
+    calc_id bigint NOT NULL
+);
+
+
+ALTER TABLE public.irc_calcs_escaped OWNER TO root;
+
+--
+-- Name: irc_ignores; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_ignores (
+    mask character varying(255) NOT NULL,
+    read_only boolean NOT NULL,
+    by character varying(255) NOT NULL,
+    "when" timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.irc_ignores OWNER TO root;
+
+--
+-- Name: irc_nick_encodings; Type: TABLE; Schema: public; Owner: root
+--
+
+CREATE TABLE public.irc_nick_encodings (
+    nick character varying(255) NOT NULL,
+    encoding character varying(32) NOT NULL,
+    "when" timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.irc_nick_encodings OWNER TO root;
+
 --
 -- Name: migrations; Type: TABLE; Schema: public; Owner: root
 --
@@ -158,6 +318,13 @@ CREATE TABLE public.migrations (
 
 ALTER TABLE public.migrations OWNER TO root;
 
+--
+-- Name: irc_calc_lookups id; Type: DEFAULT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calc_lookups ALTER COLUMN id SET DEFAULT nextval('public.irc_calc_lookups_id_seq'::regclass);
+
+
 --
 -- Name: irc_calcs id; Type: DEFAULT; Schema: public; Owner: root
 --
@@ -165,6 +332,37 @@ ALTER TABLE public.migrations OWNER TO root;
 ALTER TABLE ONLY public.irc_calcs ALTER COLUMN id SET DEFAULT nextval('public.irc_calcs_id_seq'::regclass);
 
 
+--
+-- Name: irc_calcs_audit id; Type: DEFAULT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calcs_audit ALTER COLUMN id SET DEFAULT nextval('public.irc_calcs_audit_id_seq'::regclass);
+
+
+--
+-- Name: irc_calc_lookups irc_calc_lookups_pkey; Type: CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calc_lookups
+    ADD CONSTRAINT irc_calc_lookups_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: irc_calcs_audit irc_calcs_audit_pkey; Type: CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calcs_audit
+    ADD CONSTRAINT irc_calcs_audit_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: irc_calcs_escaped irc_calcs_escaped_pkey; Type: CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calcs_escaped
+    ADD CONSTRAINT irc_calcs_escaped_pkey PRIMARY KEY (calc_id);
+
+
 --
 -- Name: irc_calcs irc_calcs_pkey; Type: CONSTRAINT; Schema: public; Owner: root
 --
@@ -173,6 +371,43 @@ ALTER TABLE ONLY public.irc_calcs
     ADD CONSTRAINT irc_calcs_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: irc_ignores irc_ignores_pkey; Type: CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_ignores
+    ADD CONSTRAINT irc_ignores_pkey PRIMARY KEY (mask);
+
+
+--
+-- Name: irc_nick_encodings irc_nick_encodings_pkey; Type: CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_nick_encodings
+    ADD CONSTRAINT irc_nick_encodings_pkey PRIMARY KEY (nick);
+
+
+--
+-- Name: audit_channel_when_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX audit_channel_when_index ON public.irc_calcs_audit USING btree (channel, "when");
+
+
+--
+-- Name: calc_picks_channel_when_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX calc_picks_channel_when_index ON public.irc_calc_picks USING btree (channel, "when");
+
+
+--
+-- Name: channel_id_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX channel_id_index ON public.irc_calcs USING btree (channel, id);
+
+
 --
 -- Name: channel_index; Type: INDEX; Schema: public; Owner: root
 --
@@ -180,6 +415,20 @@ ALTER TABLE ONLY public.irc_calcs
 CREATE INDEX channel_index ON public.irc_calcs USING btree (channel);
 
 
+--
+-- Name: channel_norm_key_when_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX channel_norm_key_when_index ON public.irc_calcs USING btree (channel, norm_key, "when");
+
+
+--
+-- Name: content_tsv_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX content_tsv_index ON public.irc_calcs USING gin (content_tsv);
+
+
 --
 -- Name: key_index; Type: INDEX; Schema: public; Owner: root
 --
@@ -187,6 +436,28 @@ CREATE INDEX channel_index ON public.irc_calcs USING btree (channel);
 CREATE INDEX key_index ON public.irc_calcs USING btree (key);
 
 
+--
+-- Name: key_trgm_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX key_trgm_index ON public.irc_calcs USING gin (key public.gin_trgm_ops);
+
+
+--
+-- Name: lookups_channel_when_index; Type: INDEX; Schema: public; Owner: root
+--
+
+CREATE INDEX lookups_channel_when_index ON public.irc_calc_lookups USING btree (channel, "when");
+
+
+--
+-- Name: irc_calcs_audit irc_calcs_audit_calc_id_fkey; Type: FK CONSTRAINT; Schema: public; Owner: root
+--
+
+ALTER TABLE ONLY public.irc_calcs_audit
+    ADD CONSTRAINT irc_calcs_audit_calc_id_fkey FOREIGN KEY (calc_id) REFERENCES public.irc_calcs(id);
+
+
 --
 -- PostgreSQL database dump complete
 --
@@ -0,0 +1,12 @@
+module github.com/whyrusleeping/hellabot
+
+go 1.14
+
+require (
+	github.com/ftrvxmtrx/fd v0.0.0-20150925145434-c6d800382fff
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/inconshreveable/log15 v0.0.0-20200109203555-b30bc20e4fd1 // indirect
+	github.com/mattn/go-colorable v0.1.6 // indirect
+	gopkg.in/inconshreveable/log15.v2 v2.0.0-20200109203555-b30bc20e4fd1
+	gopkg.in/sorcix/irc.v2 v2.0.0-20200812151606-3f15758ea8c7
+)
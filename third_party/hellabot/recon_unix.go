@@ -0,0 +1,90 @@
+// +build freebsd openbsd dragonfly netbsd darwin
+
+package hbot
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/ftrvxmtrx/fd"
+)
+
+// StartUnixListener starts up a unix domain socket listener for reconnects to
+// be sent through
+func (bot *Bot) StartUnixListener() {
+	unaddr, err := net.ResolveUnixAddr("unix", bot.unixsock)
+	if err != nil {
+		bot.Error("unix listener error", "err", err)
+		return
+	}
+
+	// Unlink the socket so we don't have to worry about removing it
+	// We can ignore any error here
+	syscall.Unlink(bot.unixsock)
+
+	list, err := net.ListenUnix("unix", unaddr)
+	if err != nil {
+		bot.Error("unix listener error", "err", err)
+		return
+	}
+	defer list.Close()
+	if !bot.setUnixListener(list) {
+		return
+	}
+
+	con, err := list.AcceptUnix()
+	if err != nil {
+		fmt.Println("unix listener error: ", err)
+		return
+	}
+	defer con.Close()
+
+	tcp, ok := bot.con.(*net.TCPConn)
+	if !ok {
+		bot.Error("unix listener error", "err", "only plain TCP connections can be handed over")
+		return
+	}
+	fi, err := tcp.File()
+	if err != nil {
+		bot.Error("unix listener error", "err", err)
+		return
+	}
+
+	err = fd.Put(con, fi)
+	if err != nil {
+		bot.Error("unix listener error", "err", err)
+		return
+	}
+
+	select {
+	case <-bot.Incoming:
+	default:
+		close(bot.Incoming)
+	}
+	bot.disconnect()
+}
+
+// Attempt to hijack session previously running bot
+func (bot *Bot) hijackSession() bool {
+	con, err := net.Dial("unix", bot.unixsock)
+	if err != nil {
+		bot.Info("Couldnt restablish connection, no prior bot.", "err", err)
+		return false
+	}
+	defer con.Close()
+
+	ncon, err := fd.Get(con.(*net.UnixConn), 1, nil)
+	if err != nil {
+		panic(err)
+	}
+	defer ncon[0].Close()
+
+	netcon, err := net.FileConn(ncon[0])
+	if err != nil {
+		panic(err)
+	}
+	bot.reconnecting = true
+	bot.con = netcon
+	return true
+}